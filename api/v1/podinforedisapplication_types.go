@@ -18,13 +18,22 @@ package v1
 
 import (
 	"fmt"
+	"net/url"
 	"reflect"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/samber/lo"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 )
 
 // PodInfoRedisApplicationSpec defines the desired state of PodInfoRedisApplication
@@ -39,8 +48,52 @@ type PodInfoRedisApplicationSpec struct {
 	Image        `json:"image,omitempty"`
 	UI           `json:"ui,omitempty"`
 	Redis        `json:"redis,omitempty"`
+	Probes       `json:"probes,omitempty"`
+	// Disruption budget applied to each component. No PodDisruptionBudgets are created
+	// unless minAvailable or maxUnavailable is set, nor for a component running a single pod:
+	// PodInfo with one replica, or Redis in the standalone mode.
+	DisruptionBudget `json:"disruptionBudget,omitempty"`
+	// Horizontal autoscaling of PodInfo. While enabled, replicaCount is ignored.
+	Autoscaling `json:"autoscaling,omitempty"`
+	// How PodInfo is exposed: its Service type, and optionally an Ingress or HTTPRoute.
+	Expose `json:"expose,omitempty"`
+	// How the PodInfo Deployment replaces its pods when the spec changes.
+	Rollout `json:"rollout,omitempty"`
+	// What becomes of the Redis claims and generated Secrets when the application is
+	// deleted. Defaults to Retain.
+	// +kubebuilder:default:=Retain
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+	// Stops the operator from applying changes to the application's objects, so that they
+	// can be edited by hand, while its status is still reported. The paused annotation has
+	// the same effect.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+}
+
+// AnnotationPaused pauses the application while set to "true", like spec.paused.
+var AnnotationPaused = fmt.Sprintf("%v/paused", GroupVersion.Group)
+
+// Paused reports whether the operator is to leave the objects of pira as they are.
+func (pira *PodInfoRedisApplication) Paused() bool {
+	return pira.Spec.Paused || pira.Annotations[AnnotationPaused] == "true"
 }
 
+// DeletionPolicy selects which objects outlive a deleted application.
+// +kubebuilder:validation:Enum:=Delete;Orphan;Retain
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete deletes every object of the application, including the Redis
+	// claims.
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyOrphan leaves every object of the application running, no longer owned.
+	DeletionPolicyOrphan DeletionPolicy = "Orphan"
+	// DeletionPolicyRetain deletes the workloads but keeps the Redis claims and generated
+	// Secrets, so that an application created again under the same name reuses them.
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+)
+
 type Resources struct {
 	MemoryLimit resource.Quantity `json:"memoryLimit,omitempty"`
 	CpuRequest  resource.Quantity `json:"cpuRequest,omitempty"`
@@ -63,17 +116,635 @@ type UI struct {
 type Redis struct {
 	// Enables a Redis datastore for PodInfo containers.
 	Enabled bool `json:"enabled,omitempty"`
+	// Connects PodInfo to a Redis the operator doesn't manage. May not be set together with
+	// enabled, as no Redis is created for it.
+	// +optional
+	External *ExternalRedis `json:"external,omitempty"`
+	// Persists Redis data on a PersistentVolumeClaim, running Redis as a StatefulSet instead
+	// of a Deployment. Without it, Redis data is lost whenever its pod restarts.
+	// +optional
+	Persistence *Persistence `json:"persistence,omitempty"`
+	// Password authentication for Redis.
+	Auth RedisAuth `json:"auth,omitempty"`
+	// TLS for connections to Redis.
+	TLS RedisTLS `json:"tls,omitempty"`
+	// Topology of Redis: a single pod, a primary followed by replicas, or a primary and
+	// replicas with Sentinel failing over to a replica when the primary goes down. PodInfo
+	// always connects to the current primary.
+	// +kubebuilder:default:=standalone
+	// +optional
+	Mode RedisMode `json:"mode,omitempty"`
+	// Number of replicas following the primary in the replicated and sentinel modes.
+	// +kubebuilder:default:=2
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+	// Sentinel quorum in the sentinel mode.
+	Sentinel RedisSentinel `json:"sentinel,omitempty"`
+	// Container image of Redis.
+	Image RedisImage `json:"image,omitempty"`
+	// Compute resources of the Redis container.
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+	// Directives rendered into redis.conf, such as maxmemory: 100mb. Directives the operator
+	// manages itself (port, tls-*, requirepass, dir, include, save and appendonly) can't be set. Changing the
+	// config rolls out Redis.
+	// +optional
+	Config map[string]string `json:"config,omitempty"`
+}
+
+// RedisMode selects the Redis topology.
+// +kubebuilder:validation:Enum:=standalone;replicated;sentinel
+type RedisMode string
+
+const (
+	RedisModeStandalone RedisMode = "standalone"
+	RedisModeReplicated RedisMode = "replicated"
+	RedisModeSentinel   RedisMode = "sentinel"
+)
+
+// Replicated reports whether the mode runs a primary with replicas.
+func (mode RedisMode) Replicated() bool {
+	return mode == RedisModeReplicated || mode == RedisModeSentinel
+}
+
+// RedisSentinel configures the Sentinel pods that monitor the primary in the sentinel mode.
+type RedisSentinel struct {
+	// Number of Sentinel pods.
+	// +kubebuilder:default:=3
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+	// Number of Sentinels that must agree the primary is down before failing over. Must not
+	// exceed replicas.
+	// +kubebuilder:default:=2
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	Quorum *int32 `json:"quorum,omitempty"`
 }
 
+// RedisImage selects the Redis container image. A digest pins the image regardless of tag.
+type RedisImage struct {
+	// Repository of the Redis container image.
+	Repository string `json:"repository,omitempty"`
+	// Tag of the Redis container image.
+	Tag string `json:"tag,omitempty"`
+	// Digest of the Redis container image, such as sha256:<hex>.
+	// +kubebuilder:validation:Pattern:=`^sha256:[a-f0-9]{64}$`
+	// +optional
+	Digest string `json:"digest,omitempty"`
+	// Pull policy of the Redis container image. Defaults to Always for a latest tag, and
+	// IfNotPresent otherwise.
+	// +kubebuilder:validation:Enum:=Always;Never;IfNotPresent
+	// +optional
+	PullPolicy corev1.PullPolicy `json:"pullPolicy,omitempty"`
+}
+
+// String returns the image reference, falling back to the default repository and tag.
+func (image RedisImage) String() string {
+	ref := lo.Ternary(image.Repository != "", image.Repository, DefaultRedisImageRepository)
+	if image.Tag != "" {
+		ref = fmt.Sprintf("%v:%v", ref, image.Tag)
+	} else if image.Digest == "" {
+		ref = fmt.Sprintf("%v:%v", ref, DefaultRedisImageTag)
+	}
+	if image.Digest != "" {
+		ref = fmt.Sprintf("%v@%v", ref, image.Digest)
+	}
+	return ref
+}
+
+// ExternalRedis locates a Redis run outside the operator, such as a managed service.
+type ExternalRedis struct {
+	// Address of Redis as host:port.
+	Address string `json:"address"`
+	// Connects to Redis with TLS, trusting the system's CA certificates.
+	// +optional
+	TLS bool `json:"tls,omitempty"`
+	// Key of a Secret in the application's namespace holding the Redis password. Changing the
+	// password rolls out PodInfo. Without it, PodInfo connects without authenticating.
+	// +optional
+	PasswordSecret *corev1.SecretKeySelector `json:"passwordSecret,omitempty"`
+	// Checks that the operator can open TCP connections to the address, reporting the outcome
+	// in the RedisReachable condition.
+	// +optional
+	ReachabilityCheck bool `json:"reachabilityCheck,omitempty"`
+}
+
+// RedisAuth configures where the Redis password comes from. Changing the password rolls out
+// Redis and PodInfo together.
+type RedisAuth struct {
+	// Key of a Secret in the application's namespace holding the Redis password. Defaults to a
+	// generated password kept in the <name>-redis-auth Secret; delete that Secret to rotate it.
+	// +optional
+	ExistingSecret *corev1.SecretKeySelector `json:"existingSecret,omitempty"`
+}
+
+// RedisTLS configures TLS on the Redis port. While enabled, Redis only accepts TLS connections.
+type RedisTLS struct {
+	// Serves Redis over TLS, and connects PodInfo to it with TLS.
+	Enabled bool `json:"enabled,omitempty"`
+	// Name of a kubernetes.io/tls Secret in the application's namespace holding the Redis
+	// certificate and key, and the CA certificate that issued them under ca.crt. The
+	// certificate must be valid for <name>-redis. Defaults to a certificate the operator
+	// issues from its own self-signed CA and renews before it expires.
+	// +optional
+	ExistingSecret string `json:"existingSecret,omitempty"`
+}
+
+// PersistenceMode selects how Redis writes its data to disk.
+// +kubebuilder:validation:Enum:=RDB;AOF
+type PersistenceMode string
+
+const (
+	// PersistenceModeRDB saves point-in-time snapshots of the dataset.
+	PersistenceModeRDB PersistenceMode = "RDB"
+	// PersistenceModeAOF logs every write to an append-only file.
+	PersistenceModeAOF PersistenceMode = "AOF"
+)
+
+// Persistence configures the PersistentVolumeClaim Redis stores its data on. storageClassName
+// and size can't be changed once set; disable and re-enable persistence to replace the claim.
+type Persistence struct {
+	// StorageClass of the claim. Defaults to the cluster's default StorageClass.
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
+	// Size of the claim.
+	// +kubebuilder:default:="1Gi"
+	// +optional
+	Size resource.Quantity `json:"size,omitempty"`
+	// How Redis persists data. Defaults to RDB.
+	// +kubebuilder:default:=RDB
+	// +optional
+	Mode PersistenceMode `json:"mode,omitempty"`
+	// Whether the claim is kept or deleted along with the Redis StatefulSet when persistence
+	// or Redis is disabled. Defaults to Retain. A retained claim is reused when persistence
+	// is enabled again. When the application is deleted, its deletionPolicy decides instead.
+	// +kubebuilder:validation:Enum:=Retain;Delete
+	// +kubebuilder:default:=Retain
+	// +optional
+	RetentionPolicy appsv1.PersistentVolumeClaimRetentionPolicyType `json:"retentionPolicy,omitempty"`
+	// Saves the dataset to the claim before Redis is deleted along with the application,
+	// unless its deletionPolicy is Delete.
+	// +optional
+	SnapshotOnDelete bool `json:"snapshotOnDelete,omitempty"`
+}
+
+type Probes struct {
+	// Overrides for the liveness probe, which defaults to GET /healthz.
+	// +optional
+	Liveness *Probe `json:"liveness,omitempty"`
+	// Overrides for the readiness probe, which defaults to GET /readyz.
+	// +optional
+	Readiness *Probe `json:"readiness,omitempty"`
+	// Overrides for the startup probe, which defaults to GET /healthz.
+	// +optional
+	Startup *Probe `json:"startup,omitempty"`
+}
+
+// Probe overrides the settings of an HTTP probe against the PodInfo port. Unset fields keep
+// their defaults.
+type Probe struct {
+	// HTTP path to probe.
+	// +kubebuilder:validation:Pattern:=`^/`
+	// +optional
+	Path string `json:"path,omitempty"`
+	// Seconds after the container starts before the probe is first run.
+	// +kubebuilder:validation:Minimum:=0
+	// +optional
+	InitialDelaySeconds *int32 `json:"initialDelaySeconds,omitempty"`
+	// Seconds between probes.
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	PeriodSeconds *int32 `json:"periodSeconds,omitempty"`
+	// Seconds after which a probe times out.
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+	// Consecutive successes needed to pass after a failure. Must be 1 for liveness and startup probes.
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	SuccessThreshold *int32 `json:"successThreshold,omitempty"`
+	// Consecutive failures needed to fail.
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	FailureThreshold *int32 `json:"failureThreshold,omitempty"`
+}
+
+// DisruptionBudget limits how many pods of a component voluntary disruptions, such as node
+// drains, may take down at once. At most one of its fields may be set.
+type DisruptionBudget struct {
+	// Number or percentage of pods that must remain available.
+	// +optional
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+	// Number or percentage of pods that may be unavailable.
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// Enabled reports whether PodDisruptionBudgets should be created.
+func (db DisruptionBudget) Enabled() bool {
+	return db.MinAvailable != nil || db.MaxUnavailable != nil
+}
+
+// Rollout configures the strategy of the PodInfo Deployment. Fields left unset take the
+// Deployment's defaults.
+type Rollout struct {
+	// RollingUpdate, the default, replaces pods a few at a time; Recreate deletes every pod
+	// before creating new ones.
+	// +kubebuilder:validation:Enum:=RollingUpdate;Recreate
+	// +optional
+	Strategy appsv1.DeploymentStrategyType `json:"strategy,omitempty"`
+	// Number or percentage of pods a rolling update may create above the replica count.
+	// Defaults to 25%.
+	// +optional
+	MaxSurge *intstr.IntOrString `json:"maxSurge,omitempty"`
+	// Number or percentage of pods a rolling update may take down below the replica count.
+	// Defaults to 25%.
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+	// Seconds a new pod must be ready for before it counts as available.
+	// +kubebuilder:validation:Minimum:=0
+	// +optional
+	MinReadySeconds int32 `json:"minReadySeconds,omitempty"`
+	// Seconds a rollout may go without progress before it is reported as failed, in the
+	// Progressing condition. Defaults to 600.
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	ProgressDeadlineSeconds *int32 `json:"progressDeadlineSeconds,omitempty"`
+	// Number of old ReplicaSets kept to roll back to. Defaults to 10.
+	// +kubebuilder:validation:Minimum:=0
+	// +optional
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+	// Rolls changes of the PodInfo image out through a canary Deployment run alongside the
+	// stable one, which is only updated once the canary has passed every step. Setting it
+	// labels the stable pods with their track, which rolls them out once.
+	// +optional
+	Progressive *ProgressiveRollout `json:"progressive,omitempty"`
+	// Reverts the PodInfo Deployment to the pod template of its last available revision
+	// when a new revision doesn't become available in time. The spec is left as it is.
+	// +optional
+	AutoRollback *AutoRollback `json:"autoRollback,omitempty"`
+}
+
+// AutoRollback configures the automatic rollback of PodInfo revisions.
+type AutoRollback struct {
+	// Seconds a new revision may take to become available before it is rolled back.
+	// Defaults to 600.
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	DeadlineSeconds *int32 `json:"deadlineSeconds,omitempty"`
+}
+
+// Deadline returns how long a new revision may take to become available.
+func (a *AutoRollback) Deadline() time.Duration {
+	return time.Duration(lo.FromPtrOr(a.DeadlineSeconds, 600)) * time.Second
+}
+
+// ProgressiveRollout configures how a new PodInfo image is rolled out through the
+// <name>-podinfo-canary Deployment.
+type ProgressiveRollout struct {
+	// Canary, the default, shifts traffic to the canary in steps; BlueGreen runs the canary
+	// at full scale without traffic, then switches every request to it at once.
+	// +kubebuilder:validation:Enum:=Canary;BlueGreen
+	// +optional
+	Strategy ProgressiveStrategy `json:"strategy,omitempty"`
+	// Percentages of traffic sent to the canary, in increasing order, before it is promoted.
+	// Only used by the Canary strategy. Defaults to 10 and 50.
+	// +kubebuilder:validation:items:Minimum:=1
+	// +kubebuilder:validation:items:Maximum:=99
+	// +optional
+	Steps []int32 `json:"steps,omitempty"`
+	// ReplicaRatio, the default, shifts traffic by the number of canary and stable replicas
+	// behind the PodInfo Service; GatewayWeight sets the weights of the HTTPRoute backends,
+	// and requires expose.httpRoute.
+	// +kubebuilder:validation:Enum:=ReplicaRatio;GatewayWeight
+	// +optional
+	TrafficRouting TrafficRouting `json:"trafficRouting,omitempty"`
+	// Readiness, the default, passes a step once every canary pod is available; HTTP also
+	// requires /healthz to answer through the <name>-podinfo-canary Service.
+	// +kubebuilder:validation:Enum:=Readiness;HTTP
+	// +optional
+	Check RolloutCheck `json:"check,omitempty"`
+	// Seconds each step lasts at least, moving on once the canary passes its check. Defaults
+	// to 30.
+	// +kubebuilder:validation:Minimum:=0
+	// +optional
+	StepSeconds *int32 `json:"stepSeconds,omitempty"`
+	// Seconds a step may fail its check before the canary is rolled back. Defaults to 300.
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	DeadlineSeconds *int32 `json:"deadlineSeconds,omitempty"`
+}
+
+// ProgressiveStrategy selects how traffic moves to a canary.
+type ProgressiveStrategy string
+
+const (
+	ProgressiveStrategyCanary    ProgressiveStrategy = "Canary"
+	ProgressiveStrategyBlueGreen ProgressiveStrategy = "BlueGreen"
+)
+
+// TrafficRouting selects how traffic is split between the stable and canary pods.
+type TrafficRouting string
+
+const (
+	TrafficRoutingReplicaRatio  TrafficRouting = "ReplicaRatio"
+	TrafficRoutingGatewayWeight TrafficRouting = "GatewayWeight"
+)
+
+// RolloutCheck selects what a canary must pass at each step.
+type RolloutCheck string
+
+const (
+	RolloutCheckReadiness RolloutCheck = "Readiness"
+	RolloutCheckHTTP      RolloutCheck = "HTTP"
+)
+
+// Weights returns the percentages of traffic the canary receives at each step. The
+// BlueGreen strategy has a single step, at which the canary receives none.
+func (p *ProgressiveRollout) Weights() []int32 {
+	switch {
+	case p.Strategy == ProgressiveStrategyBlueGreen:
+		return []int32{0}
+	case len(p.Steps) == 0:
+		return []int32{10, 50}
+	default:
+		return p.Steps
+	}
+}
+
+// StepDuration returns how long each step must pass its check for.
+func (p *ProgressiveRollout) StepDuration() time.Duration {
+	return time.Duration(lo.FromPtrOr(p.StepSeconds, 30)) * time.Second
+}
+
+// Deadline returns how long a step may fail its check for.
+func (p *ProgressiveRollout) Deadline() time.Duration {
+	return time.Duration(lo.FromPtrOr(p.DeadlineSeconds, 300)) * time.Second
+}
+
+// strategy returns the Deployment strategy r configures, left empty for the defaults.
+func (r Rollout) strategy() appsv1.DeploymentStrategy {
+	if r.Strategy == appsv1.RecreateDeploymentStrategyType {
+		return appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType}
+	}
+	if r.MaxSurge == nil && r.MaxUnavailable == nil {
+		return appsv1.DeploymentStrategy{Type: r.Strategy}
+	}
+	return appsv1.DeploymentStrategy{
+		Type:          appsv1.RollingUpdateDeploymentStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateDeployment{MaxSurge: r.MaxSurge, MaxUnavailable: r.MaxUnavailable},
+	}
+}
+
+// Autoscaling configures a HorizontalPodAutoscaler for the PodInfo Deployment. Without a
+// utilization target the HorizontalPodAutoscaler scales on 80% CPU utilization.
+type Autoscaling struct {
+	// Enables autoscaling of PodInfo, which then owns the replica count of its Deployment.
+	Enabled bool `json:"enabled,omitempty"`
+	// Lower limit for the number of PodInfo replicas. Defaults to 1.
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+	// Upper limit for the number of PodInfo replicas. Required when autoscaling is enabled.
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	MaxReplicas int32 `json:"maxReplicas,omitempty"`
+	// Target average CPU utilization, as a percentage of the CPU request.
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+	// Target average memory utilization, as a percentage of the memory request.
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	TargetMemoryUtilizationPercentage *int32 `json:"targetMemoryUtilizationPercentage,omitempty"`
+	// Scaling policies for scaling up and down.
+	// +optional
+	Behavior *autoscalingv2.HorizontalPodAutoscalerBehavior `json:"behavior,omitempty"`
+}
+
+// Expose configures how PodInfo is reached. At most one of ingress and httpRoute may be set.
+type Expose struct {
+	// Type of the PodInfo Service. Defaults to NodePort.
+	// +kubebuilder:validation:Enum:=ClusterIP;NodePort;LoadBalancer
+	// +optional
+	ServiceType corev1.ServiceType `json:"serviceType,omitempty"`
+	// Exposes PodInfo through an Ingress.
+	// +optional
+	Ingress *Ingress `json:"ingress,omitempty"`
+	// Exposes PodInfo through a Gateway API HTTPRoute. Requires the Gateway API CRDs.
+	// +optional
+	HTTPRoute *HTTPRoute `json:"httpRoute,omitempty"`
+}
+
+// Route holds the settings shared by Ingress and HTTPRoute exposure.
+type Route struct {
+	// Host name PodInfo is served on.
+	// +kubebuilder:validation:MinLength:=1
+	Host string `json:"host"`
+	// Path prefix PodInfo is served under. Defaults to /.
+	// +kubebuilder:validation:Pattern:=`^/`
+	// +optional
+	Path string `json:"path,omitempty"`
+	// Annotations added to the generated object, e.g. to configure the controller serving it.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type Ingress struct {
+	Route `json:",inline"`
+	// Name of the IngressClass to use. Defaults to the cluster's default IngressClass.
+	// +optional
+	ClassName *string `json:"className,omitempty"`
+	// Name of the Secret holding the TLS certificate for host. When set, the Ingress
+	// terminates TLS for host.
+	// +optional
+	TLSSecretName string `json:"tlsSecretName,omitempty"`
+}
+
+type HTTPRoute struct {
+	Route `json:",inline"`
+	// Gateways the HTTPRoute attaches to. TLS is terminated by their listeners, which
+	// reference the certificate for host.
+	// +kubebuilder:validation:MinItems:=1
+	ParentRefs []gatewayv1.ParentReference `json:"parentRefs"`
+}
+
+func (r Route) path() string {
+	return lo.Ternary(r.Path == "", "/", r.Path)
+}
+
+// Condition types reported on a PodInfoRedisApplication.
+const (
+	// ConditionReady is True when every enabled component is available.
+	ConditionReady = "Ready"
+	// ConditionPodInfoAvailable mirrors the Available condition of the PodInfo Deployment.
+	ConditionPodInfoAvailable = "PodInfoAvailable"
+	// ConditionRedisAvailable mirrors the Available condition of the Redis Deployment, or
+	// reports whether every replica of the Redis StatefulSet, and of the Sentinel one in the
+	// sentinel mode, is available.
+	// It is only reported while Redis is enabled.
+	ConditionRedisAvailable = "RedisAvailable"
+	// ConditionRedisReachable reports whether the operator could connect to an external Redis.
+	// It is only reported while its reachabilityCheck is enabled.
+	ConditionRedisReachable = "RedisReachable"
+	// ConditionCacheEnabled reports which Redis PodInfo caches in, and is False while PodInfo
+	// runs without a cache. It does not affect Ready.
+	ConditionCacheEnabled = "CacheEnabled"
+	// ConditionProgressing is True while a component is rolling out, and False with the
+	// Deployment's reason, such as ProgressDeadlineExceeded, once a rollout has failed.
+	ConditionProgressing = "Progressing"
+	// ConditionDegraded is True when the last reconcile failed or a component is failing.
+	ConditionDegraded = "Degraded"
+	// ConditionRolledBack is True while PodInfo runs its last known-good pod template in
+	// place of a revision that didn't become available. It is only reported while
+	// rollout.autoRollback is set.
+	ConditionRolledBack = "RolledBack"
+	// ConditionPaused is True while the application is paused. It is removed once the
+	// objects have been applied again after resuming.
+	ConditionPaused = "Paused"
+)
+
 // PodInfoRedisApplicationStatus defines the observed state of PodInfoRedisApplication
 type PodInfoRedisApplicationStatus struct {
-	// TODO add Conditions
+	// Generation of the spec most recently acted on by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Replica counts of the PodInfo Deployment.
+	// +optional
+	PodInfo ComponentStatus `json:"podInfo,omitempty"`
+	// Replica counts of the Redis Deployment or StatefulSet. Unset while Redis is disabled.
+	// +optional
+	Redis *ComponentStatus `json:"redis,omitempty"`
+	// Pod serving as the Redis primary in the replicated and sentinel modes.
+	// +optional
+	RedisPrimary string `json:"redisPrimary,omitempty"`
+	// URL PodInfo is served on: the Ingress or HTTPRoute host if either is configured,
+	// otherwise the Service address.
+	// +optional
+	URL string `json:"url,omitempty"`
+	// Objects the operator applied for the application, which it deletes once they are no
+	// longer needed.
+	// +optional
+	Inventory []InventoryEntry `json:"inventory,omitempty"`
+	// Progress of the rollout of the PodInfo image. Only reported while rollout.progressive
+	// is set.
+	// +optional
+	Rollout *RolloutStatus `json:"rollout,omitempty"`
+	// Revisions of PodInfo automatic rollback keeps track of. Only reported while
+	// rollout.autoRollback is set.
+	// +optional
+	AutoRollback *AutoRollbackStatus `json:"autoRollback,omitempty"`
+	// Latest observations of the application's state.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// AutoRollbackStatus records the revisions of the PodInfo Deployment automatic rollback acts on.
+type AutoRollbackStatus struct {
+	// Last revision of PodInfo that became available, and the checksum of its pod template,
+	// by which its ReplicaSet is found again, as the revision is renumbered once rolled back to.
+	// +optional
+	KnownGoodRevision string `json:"knownGoodRevision,omitempty"`
+	// +optional
+	KnownGoodTemplateChecksum string `json:"knownGoodTemplateChecksum,omitempty"`
+	// Latest revision of the PodInfo Deployment, and when the operator first saw it.
+	// +optional
+	Revision string `json:"revision,omitempty"`
+	// +optional
+	RevisionTime *metav1.Time `json:"revisionTime,omitempty"`
+	// Revision that was rolled back, and the checksum of the pod template the spec asked
+	// for. The known-good template is kept in place until the spec changes the template.
+	// +optional
+	FailedRevision string `json:"failedRevision,omitempty"`
+	// +optional
+	FailedTemplateChecksum string `json:"failedTemplateChecksum,omitempty"`
+}
+
+// RolloutStatus tracks a progressive rollout of the PodInfo image.
+type RolloutStatus struct {
+	Phase RolloutPhase `json:"phase"`
+	// Image the stable Deployment runs.
+	StableImage string `json:"stableImage"`
+	// Image of the canary being rolled out, or that was last rolled back.
+	// +optional
+	CanaryImage string `json:"canaryImage,omitempty"`
+	// Index of the step the canary is at.
+	// +optional
+	Step int32 `json:"step,omitempty"`
+	// Percentage of traffic sent to the canary.
+	// +optional
+	Weight int32 `json:"weight,omitempty"`
+	// When the current step started.
+	// +optional
+	StepStartTime *metav1.Time `json:"stepStartTime,omitempty"`
+	// Latest rollouts that were promoted or rolled back, oldest first.
+	// +optional
+	History []RolloutRecord `json:"history,omitempty"`
+}
+
+// RolloutPhase is the stage a progressive rollout is at.
+type RolloutPhase string
+
+const (
+	// RolloutPhaseStable means no canary is running.
+	RolloutPhaseStable RolloutPhase = "Stable"
+	// RolloutPhaseProgressing means the canary is going through its steps.
+	RolloutPhaseProgressing RolloutPhase = "Progressing"
+	// RolloutPhasePromoting means the canary passed every step and receives all traffic
+	// while the stable Deployment is updated to its image.
+	RolloutPhasePromoting RolloutPhase = "Promoting"
+	// RolloutPhaseRolledBack means the canary failed a step and was removed. The stable
+	// image keeps running until spec.image changes again.
+	RolloutPhaseRolledBack RolloutPhase = "RolledBack"
+)
+
+// RolloutRecord is the outcome of a finished rollout.
+type RolloutRecord struct {
+	Image  string        `json:"image"`
+	Result RolloutResult `json:"result"`
+	Time   metav1.Time   `json:"time"`
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// RolloutResult is how a progressive rollout ended.
+type RolloutResult string
+
+const (
+	RolloutResultPromoted   RolloutResult = "Promoted"
+	RolloutResultRolledBack RolloutResult = "RolledBack"
+)
+
+// InventoryEntry identifies an object in the namespace of the application.
+type InventoryEntry struct {
+	// +optional
+	Group   string `json:"group,omitempty"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+}
+
+type ComponentStatus struct {
+	// Number of replicas requested by the Deployment spec.
+	Replicas int32 `json:"replicas"`
+	// Number of replicas passing their readiness probe.
+	ReadyReplicas int32 `json:"readyReplicas"`
 }
 
 // PodInfoRedisApplication is the Schema for the podinforedisapplication API
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:path=podinforedisapplication,shortName={pira}
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="PodInfo",type=integer,JSONPath=`.status.podInfo.readyReplicas`
+// +kubebuilder:printcolumn:name="Redis",type=integer,JSONPath=`.status.redis.readyReplicas`
+// +kubebuilder:printcolumn:name="Primary",type=string,JSONPath=`.status.redisPrimary`,priority=1
+// +kubebuilder:printcolumn:name="URL",type=string,JSONPath=`.status.url`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 type PodInfoRedisApplication struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -95,6 +766,114 @@ func init() {
 	SchemeBuilder.Register(&PodInfoRedisApplication{}, &PodInfoRedisApplicationList{})
 }
 
+// podInfoEnv configures PodInfo. Only while Redis is enabled or external is PodInfo given a
+// cache server, whose URL carries the Redis password, which Kubernetes expands from
+// REDIS_PASSWORD when starting the container, and uses the rediss scheme if Redis serves TLS.
+// REDIS_PASSWORD is read from PodInfoRedisPasswordSecret, where the password is percent-encoded.
+func (pira *PodInfoRedisApplication) podInfoEnv() []corev1.EnvVar {
+	env := []corev1.EnvVar{
+		{
+			Name:  "PODINFO_UI_COLOR",
+			Value: pira.Spec.UI.Color,
+		},
+		{
+			Name:  "PODINFO_UI_MESSAGE",
+			Value: pira.Spec.UI.Message,
+		},
+	}
+	if external := pira.Spec.Redis.External; external != nil {
+		scheme := lo.Ternary(external.TLS, "rediss", "tcp")
+		if external.PasswordSecret == nil {
+			return append(env, corev1.EnvVar{
+				Name:  "PODINFO_CACHE_SERVER",
+				Value: fmt.Sprintf("%v://%v", scheme, external.Address),
+			})
+		}
+		return append(env,
+			corev1.EnvVar{
+				Name:      "REDIS_PASSWORD",
+				ValueFrom: &corev1.EnvVarSource{SecretKeyRef: lo.ToPtr(pira.PodInfoRedisPasswordSecretKeySelector())},
+			},
+			corev1.EnvVar{
+				Name:  "PODINFO_CACHE_SERVER",
+				Value: fmt.Sprintf("%v://:$(REDIS_PASSWORD)@%v", scheme, external.Address),
+			},
+		)
+	}
+	if !pira.Spec.Redis.Enabled {
+		// Without a cache server, PodInfo keeps its cache endpoints off rather than failing them.
+		return env
+	}
+	scheme := "tcp"
+	if pira.Spec.Redis.TLS.Enabled {
+		scheme = "rediss"
+		env = append(env, corev1.EnvVar{Name: "SSL_CERT_FILE", Value: "/etc/podinfo/redis-tls/ca.crt"})
+	}
+	return append(env,
+		corev1.EnvVar{
+			Name:      "REDIS_PASSWORD",
+			ValueFrom: &corev1.EnvVarSource{SecretKeyRef: lo.ToPtr(pira.PodInfoRedisPasswordSecretKeySelector())},
+		},
+		corev1.EnvVar{
+			Name:  "PODINFO_CACHE_SERVER",
+			Value: fmt.Sprintf("%v://:$(REDIS_PASSWORD)@%v", scheme, pira.ManagedRedisAddress()),
+		},
+	)
+}
+
+// ManagedRedisAddress returns the address PodInfo reaches the managed Redis at.
+func (pira *PodInfoRedisApplication) ManagedRedisAddress() string {
+	return fmt.Sprintf("%v-redis:6379", pira.Name)
+}
+
+// RedisPasswordSecretKeySelector returns the Secret key holding the Redis password: the
+// user's existing Secret if one is referenced, otherwise the one RedisAuthSecret builds.
+func (pira *PodInfoRedisApplication) RedisPasswordSecretKeySelector() corev1.SecretKeySelector {
+	if ref := pira.Spec.Redis.Auth.ExistingSecret; ref != nil {
+		return *ref
+	}
+	return corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: fmt.Sprintf("%v-%v", pira.Name, "redis-auth")},
+		Key:                  "password",
+	}
+}
+
+// PodInfoRedisPasswordSecretKeySelector returns the Secret key PodInfo reads the Redis
+// password from, which PodInfoRedisPasswordSecret builds.
+func (pira *PodInfoRedisApplication) PodInfoRedisPasswordSecretKeySelector() corev1.SecretKeySelector {
+	return corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: fmt.Sprintf("%v-%v", pira.Name, "podinfo-redis-auth")},
+		Key:                  "password",
+	}
+}
+
+// PodInfoRedisPasswordSecret holds the Redis password, from whichever Secret it comes, as it
+// appears in the cache server URL, so that PodInfo can be given any password.
+func (pira *PodInfoRedisApplication) PodInfoRedisPasswordSecret(password []byte) *corev1.Secret {
+	ref := pira.PodInfoRedisPasswordSecretKeySelector()
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: pira.Namespace,
+			Name:      ref.Name,
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{ref.Key: []byte(strings.TrimPrefix(url.UserPassword("", string(password)).String(), ":"))},
+	}
+}
+
+// RedisAuthSecret holds a generated Redis password, used unless the user references an
+// existing Secret.
+func (pira *PodInfoRedisApplication) RedisAuthSecret(password []byte) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: pira.Namespace,
+			Name:      fmt.Sprintf("%v-%v", pira.Name, "redis-auth"),
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{"password": password},
+	}
+}
+
 func (pira *PodInfoRedisApplication) RedisDeployment() *appsv1.Deployment {
 	return &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
@@ -103,48 +882,443 @@ func (pira *PodInfoRedisApplication) RedisDeployment() *appsv1.Deployment {
 		},
 		Spec: appsv1.DeploymentSpec{
 			Selector: &metav1.LabelSelector{MatchLabels: pira.labels("redis")},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{Labels: pira.labels("redis")},
-				Spec: corev1.PodSpec{
-					Containers: []corev1.Container{
+			Template: pira.redisPodTemplate(),
+		},
+	}
+}
+
+// RedisStatefulSet runs Redis with its data on a PersistentVolumeClaim. It is used in place
+// of RedisDeployment while persistence is enabled.
+func (pira *PodInfoRedisApplication) RedisStatefulSet() *appsv1.StatefulSet {
+	name := fmt.Sprintf("%v-%v", pira.Name, "redis")
+	return pira.redisStatefulSet(name, name, nil, pira.redisPodTemplate())
+}
+
+// RedisNodeStatefulSet runs the primary and replicas of the replicated and sentinel modes,
+// with their data on PersistentVolumeClaims while persistence is enabled. The first pod starts
+// out as the primary. In the sentinel mode, pods that start later follow whichever primary
+// Sentinel reports instead.
+func (pira *PodInfoRedisApplication) RedisNodeStatefulSet() *appsv1.StatefulSet {
+	template := pira.redisPodTemplate()
+	redis := &template.Spec.Containers[0]
+	redis.Command = append(redis.Command, "--masterauth", "$(REDISCLI_AUTH)")
+	if pira.Spec.Redis.TLS.Enabled {
+		redis.Command = append(redis.Command, "--tls-replication", "yes")
+	}
+	// A pod's role is only known once it starts, so the command is wrapped in a script that
+	// adds the replication arguments.
+	script := fmt.Sprintf(redisNodeScript, pira.redisNodeDomain(), pira.RedisNodeHost(pira.RedisInitialPrimary()), pira.redisPrimaryLookup())
+	redis.Command = append([]string{"sh", "-c", script, "--"}, redis.Command...)
+	return pira.redisStatefulSet(pira.redisNodeName(), pira.RedisHeadlessService().Name, lo.ToPtr(1+lo.FromPtrOr(pira.Spec.Redis.Replicas, 2)), template)
+}
+
+// redisNodeScript starts a Redis node as the primary, or as a replica of it. Its arguments
+// are the Redis command.
+const redisNodeScript = `host="$(hostname).%v"
+primary="%v"
+%v
+if [ "$host" = "$primary" ]; then
+  exec "$@" --replica-announce-ip "$host"
+fi
+exec "$@" --replica-announce-ip "$host" --replicaof "$primary" 6379
+`
+
+// redisPrimaryLookup returns a script line that sets $primary to the primary the Sentinels
+// report, if they are running and report a node of this application.
+func (pira *PodInfoRedisApplication) redisPrimaryLookup() string {
+	if pira.Spec.Redis.Mode != RedisModeSentinel {
+		return ""
+	}
+	cli := strings.Join(pira.RedisSentinelCLI(pira.RedisSentinelService().Name, "get-master-addr-by-name", RedisSentinelMaster), " ")
+	return fmt.Sprintf(`found="$(%v 2>/dev/null | head -n 1)"
+case "$found" in *.%v) primary="$found" ;; esac`, cli, pira.redisNodeDomain())
+}
+
+// redisStatefulSet runs template in a StatefulSet, mounting a PersistentVolumeClaim at /data
+// while persistence is enabled. Nil replicas means one.
+func (pira *PodInfoRedisApplication) redisStatefulSet(name, serviceName string, replicas *int32, template corev1.PodTemplateSpec) *appsv1.StatefulSet {
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: pira.Namespace,
+			Name:      name,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    replicas,
+			ServiceName: serviceName,
+			Selector:    &metav1.LabelSelector{MatchLabels: pira.labels("redis")},
+			Template:    template,
+		},
+	}
+	persistence := pira.Spec.Redis.Persistence
+	if persistence == nil {
+		return sts
+	}
+
+	redis := &sts.Spec.Template.Spec.Containers[0]
+	redis.VolumeMounts = append(redis.VolumeMounts, corev1.VolumeMount{Name: "data", MountPath: "/data"})
+	switch persistence.Mode {
+	case PersistenceModeAOF:
+		redis.Command = append(redis.Command, "--dir", "/data", "--appendonly", "yes", "--save", "")
+	default:
+		redis.Command = append(redis.Command, "--dir", "/data", "--appendonly", "no", "--save", "3600 1 300 100 60 10000")
+	}
+	sts.Spec.VolumeClaimTemplates = []corev1.PersistentVolumeClaim{{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "data",
+			Labels: pira.labels("redis"),
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			StorageClassName: persistence.StorageClassName,
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: persistence.Size},
+			},
+		},
+	}}
+	sts.Spec.PersistentVolumeClaimRetentionPolicy = &appsv1.StatefulSetPersistentVolumeClaimRetentionPolicy{
+		WhenDeleted: lo.Ternary(persistence.RetentionPolicy == "", appsv1.RetainPersistentVolumeClaimRetentionPolicyType, persistence.RetentionPolicy),
+		WhenScaled:  appsv1.RetainPersistentVolumeClaimRetentionPolicyType,
+	}
+	return sts
+}
+
+// RedisSentinelMaster is the name the Sentinels monitor the Redis primary under.
+const RedisSentinelMaster = "primary"
+
+// redisSentinelPort is the port Sentinel listens on.
+const redisSentinelPort = 26379
+
+// RedisSentinelStatefulSet runs the Sentinels of the sentinel mode. Each Sentinel writes its
+// config on start, monitoring the primary the other Sentinels report, or the first node if
+// there is none yet.
+func (pira *PodInfoRedisApplication) RedisSentinelStatefulSet() *appsv1.StatefulSet {
+	name := pira.RedisSentinelService().Name
+	sentinel := pira.Spec.Redis.Sentinel
+	script := fmt.Sprintf(redisSentinelScript,
+		fmt.Sprintf("%v.%v.svc", name, pira.Namespace),
+		pira.RedisNodeHost(pira.RedisInitialPrimary()),
+		pira.redisPrimaryLookup(),
+		RedisSentinelMaster,
+		lo.FromPtrOr(sentinel.Quorum, 2),
+	)
+	var args []string
+	if pira.Spec.Redis.TLS.Enabled {
+		args = append(redisTLSArgs(redisSentinelPort), "--tls-replication", "yes")
+	}
+
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: pira.labels("redis-sentinel")},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:            "sentinel",
+				Image:           pira.Spec.Redis.Image.String(),
+				ImagePullPolicy: pira.Spec.Redis.Image.PullPolicy,
+				Command:         append([]string{"sh", "-c", script, "--"}, args...),
+				// The Sentinels require the Redis password from their clients too, and
+				// authenticate to Redis with it.
+				Env: []corev1.EnvVar{{
+					Name:      "REDISCLI_AUTH",
+					ValueFrom: &corev1.EnvVarSource{SecretKeyRef: lo.ToPtr(pira.RedisPasswordSecretKeySelector())},
+				}},
+				Ports: []corev1.ContainerPort{{
+					Name:          "sentinel",
+					ContainerPort: redisSentinelPort,
+					Protocol:      corev1.ProtocolTCP,
+				}},
+				LivenessProbe: &corev1.Probe{
+					ProbeHandler:        corev1.ProbeHandler{TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromString("sentinel")}},
+					InitialDelaySeconds: 5,
+					TimeoutSeconds:      5,
+				},
+				ReadinessProbe: &corev1.Probe{
+					ProbeHandler:        corev1.ProbeHandler{Exec: &corev1.ExecAction{Command: pira.RedisCLI("-p", fmt.Sprint(redisSentinelPort), "ping")}},
+					InitialDelaySeconds: 5,
+					TimeoutSeconds:      5,
+				},
+				VolumeMounts: []corev1.VolumeMount{{Name: "data", MountPath: "/data"}},
+			}},
+			Volumes: []corev1.Volume{{Name: "data", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}},
+		},
+	}
+	if pira.Spec.Redis.TLS.Enabled {
+		pira.mountRedisTLS(&template)
+	}
+
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: pira.Namespace,
+			Name:      name,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    lo.ToPtr(lo.FromPtrOr(sentinel.Replicas, 3)),
+			ServiceName: name,
+			Selector:    &metav1.LabelSelector{MatchLabels: pira.labels("redis-sentinel")},
+			Template:    template,
+		},
+	}
+}
+
+// redisSentinelScript writes the Sentinel config and starts Sentinel. Its arguments are passed
+// on to Sentinel. The password is written as a quoted string, escaped as Redis reads it, so
+// that it may hold any character.
+const redisSentinelScript = `host="$(hostname).%v"
+primary="%v"
+%v
+auth="$(printf '%%s' "$REDISCLI_AUTH" | sed 's/[\\"]/\\&/g')"
+cat > /data/sentinel.conf <<EOF
+sentinel resolve-hostnames yes
+sentinel announce-hostnames yes
+sentinel announce-ip $host
+sentinel monitor %[4]v $primary 6379 %[5]v
+sentinel auth-pass %[4]v "$auth"
+sentinel down-after-milliseconds %[4]v 5000
+sentinel failover-timeout %[4]v 60000
+requirepass "$auth"
+EOF
+exec redis-sentinel /data/sentinel.conf "$@"
+`
+
+// RedisSentinelCLI returns a redis-cli command running a Sentinel command on host, or on the
+// local Sentinel if host is empty.
+func (pira *PodInfoRedisApplication) RedisSentinelCLI(host string, args ...string) []string {
+	cli := pira.RedisCLI("-p", fmt.Sprint(redisSentinelPort))
+	if host != "" {
+		cli = append(cli, "-h", host)
+	}
+	return append(append(cli, "sentinel"), args...)
+}
+
+// RedisCLI returns a redis-cli command with args, connecting over TLS while it is enabled.
+// redis-cli authenticates with the REDISCLI_AUTH environment variable.
+func (pira *PodInfoRedisApplication) RedisCLI(args ...string) []string {
+	cli := []string{"redis-cli"}
+	if pira.Spec.Redis.TLS.Enabled {
+		cli = append(cli, "--tls", "--cacert", "/tls/ca.crt")
+	}
+	return append(cli, args...)
+}
+
+// RedisInitialPrimary returns the name of the node pod that starts out as the primary. In the
+// replicated mode it stays the primary.
+func (pira *PodInfoRedisApplication) RedisInitialPrimary() string {
+	return fmt.Sprintf("%v-0", pira.redisNodeName())
+}
+
+// RedisNodeHost returns the DNS name of a node pod, which nodes and Sentinels address each
+// other by.
+func (pira *PodInfoRedisApplication) RedisNodeHost(pod string) string {
+	return fmt.Sprintf("%v.%v", pod, pira.redisNodeDomain())
+}
+
+func (pira *PodInfoRedisApplication) redisNodeName() string {
+	return fmt.Sprintf("%v-%v", pira.Name, "redis-node")
+}
+
+func (pira *PodInfoRedisApplication) redisNodeDomain() string {
+	return fmt.Sprintf("%v.%v.svc", pira.RedisHeadlessService().Name, pira.Namespace)
+}
+
+// RedisHeadlessService gives each node pod a stable DNS name in the replicated and sentinel
+// modes. Addresses are published before pods are ready, so replicas can reach the primary
+// while it loads its data.
+func (pira *PodInfoRedisApplication) RedisHeadlessService() *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: pira.Namespace,
+			Name:      fmt.Sprintf("%v-%v", pira.Name, "redis-headless"),
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP:                corev1.ClusterIPNone,
+			PublishNotReadyAddresses: true,
+			Selector:                 pira.labels("redis"),
+			Ports: []corev1.ServicePort{{
+				Name:       "redis",
+				Port:       6379,
+				Protocol:   corev1.ProtocolTCP,
+				TargetPort: intstr.FromString("redis"),
+			}},
+		},
+	}
+}
+
+// RedisSentinelService gives each Sentinel pod a stable DNS name in the sentinel mode.
+func (pira *PodInfoRedisApplication) RedisSentinelService() *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: pira.Namespace,
+			Name:      fmt.Sprintf("%v-%v", pira.Name, "redis-sentinel"),
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP:                corev1.ClusterIPNone,
+			PublishNotReadyAddresses: true,
+			Selector:                 pira.labels("redis-sentinel"),
+			Ports: []corev1.ServicePort{{
+				Name:       "sentinel",
+				Port:       redisSentinelPort,
+				Protocol:   corev1.ProtocolTCP,
+				TargetPort: intstr.FromString("sentinel"),
+			}},
+		},
+	}
+}
+
+func (pira *PodInfoRedisApplication) redisPodTemplate() corev1.PodTemplateSpec {
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: pira.labels("redis")},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:            "redis",
+					Image:           pira.Spec.Redis.Image.String(),
+					ImagePullPolicy: pira.Spec.Redis.Image.PullPolicy,
+					Resources:       pira.Spec.Redis.Resources,
+					// Arguments follow the config file, so the directives the operator manages
+					// take precedence. redis-cli, as used by the readiness probe, authenticates
+					// with REDISCLI_AUTH.
+					Command: []string{"redis-server", "/etc/redis/redis.conf", "--requirepass", "$(REDISCLI_AUTH)"},
+					Env: []corev1.EnvVar{{
+						Name:      "REDISCLI_AUTH",
+						ValueFrom: &corev1.EnvVarSource{SecretKeyRef: lo.ToPtr(pira.RedisPasswordSecretKeySelector())},
+					}},
+					Ports: []corev1.ContainerPort{
 						{
-							Name:    "redis",
-							Image:   "public.ecr.aws/docker/library/redis:latest",
-							Command: []string{"redis-server"},
-							Ports: []corev1.ContainerPort{
-								{
-									Name:          "redis",
-									ContainerPort: 6379,
-									Protocol:      corev1.ProtocolTCP,
-								},
-							},
-							LivenessProbe: &corev1.Probe{
-								ProbeHandler: corev1.ProbeHandler{
-									TCPSocket: &corev1.TCPSocketAction{
-										Port: intstr.FromString("redis"),
-									},
-								},
-								InitialDelaySeconds: 5,
-								TimeoutSeconds:      5,
+							Name:          "redis",
+							ContainerPort: 6379,
+							Protocol:      corev1.ProtocolTCP,
+						},
+					},
+					LivenessProbe: &corev1.Probe{
+						ProbeHandler: corev1.ProbeHandler{
+							TCPSocket: &corev1.TCPSocketAction{
+								Port: intstr.FromString("redis"),
 							},
-							ReadinessProbe: &corev1.Probe{
-								ProbeHandler: corev1.ProbeHandler{
-									Exec: &corev1.ExecAction{
-										Command: []string{"redis-cli", "ping"},
-									},
-								},
-								InitialDelaySeconds: 5,
-								TimeoutSeconds:      5,
+						},
+						InitialDelaySeconds: 5,
+						TimeoutSeconds:      5,
+					},
+					ReadinessProbe: &corev1.Probe{
+						ProbeHandler: corev1.ProbeHandler{
+							Exec: &corev1.ExecAction{
+								Command: []string{"redis-cli", "ping"},
 							},
 						},
+						InitialDelaySeconds: 5,
+						TimeoutSeconds:      5,
 					},
+					VolumeMounts: []corev1.VolumeMount{{Name: "config", MountPath: "/etc/redis", ReadOnly: true}},
 				},
 			},
+			Volumes: []corev1.Volume{{
+				Name: "config",
+				VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: pira.RedisConfigMap().Name},
+				}},
+			}},
 		},
 	}
+	if pira.Spec.Redis.TLS.Enabled {
+		redis := &template.Spec.Containers[0]
+		redis.Command = append(redis.Command, redisTLSArgs(6379)...)
+		redis.ReadinessProbe.Exec.Command = pira.RedisCLI("ping")
+		pira.mountRedisTLS(&template)
+	}
+	return template
+}
+
+// redisTLSArgs serves TLS on port with the certificate mounted by mountRedisTLS. Disabling the
+// plain text port leaves clients no way around TLS.
+func redisTLSArgs(port int) []string {
+	return []string{
+		"--port", "0",
+		"--tls-port", fmt.Sprint(port),
+		"--tls-cert-file", "/tls/tls.crt",
+		"--tls-key-file", "/tls/tls.key",
+		"--tls-ca-cert-file", "/tls/ca.crt",
+		"--tls-auth-clients", "no",
+	}
+}
+
+// mountRedisTLS mounts the Redis certificate at /tls in the first container of template.
+func (pira *PodInfoRedisApplication) mountRedisTLS(template *corev1.PodTemplateSpec) {
+	container := &template.Spec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{Name: "tls", MountPath: "/tls", ReadOnly: true})
+	template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+		Name:         "tls",
+		VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: pira.RedisTLSSecretName()}},
+	})
+}
+
+// RedisRoleLabel is set to RedisRolePrimary on the node pod the operator found to be the
+// Redis primary in the replicated and sentinel modes.
+var RedisRoleLabel = fmt.Sprintf("%v/redis-role", GroupVersion.Group)
+
+const RedisRolePrimary = "primary"
+
+// RedisConfigMap holds the redis.conf rendered from spec.redis.config.
+func (pira *PodInfoRedisApplication) RedisConfigMap() *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: pira.Namespace,
+			Name:      fmt.Sprintf("%v-%v", pira.Name, "redis-config"),
+		},
+		Data: map[string]string{"redis.conf": pira.redisConf()},
+	}
+}
+
+// redisConf renders spec.redis.config as redis.conf, one directive per line in key order so
+// that the checksum only changes with the config.
+func (pira *PodInfoRedisApplication) redisConf() string {
+	var conf strings.Builder
+	keys := lo.Keys(pira.Spec.Redis.Config)
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&conf, "%v %v\n", key, pira.Spec.Redis.Config[key])
+	}
+	return conf.String()
+}
+
+// RedisTLSSecretName returns the name of the Secret holding the Redis certificate: the
+// user's existing Secret if one is referenced, otherwise the one RedisTLSSecret builds.
+func (pira *PodInfoRedisApplication) RedisTLSSecretName() string {
+	if name := pira.Spec.Redis.TLS.ExistingSecret; name != "" {
+		return name
+	}
+	return fmt.Sprintf("%v-%v", pira.Name, "redis-tls")
+}
+
+// RedisTLSSecret holds a certificate the operator issued for Redis, along with its CA
+// certificate under ca.crt.
+func (pira *PodInfoRedisApplication) RedisTLSSecret(data map[string][]byte) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: pira.Namespace,
+			Name:      fmt.Sprintf("%v-%v", pira.Name, "redis-tls"),
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: data,
+	}
+}
+
+// RedisCASecret holds the self-signed CA the operator issues Redis certificates from. It is
+// kept apart from RedisTLSSecret so the CA key is never mounted into a pod.
+func (pira *PodInfoRedisApplication) RedisCASecret(data map[string][]byte) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: pira.Namespace,
+			Name:      fmt.Sprintf("%v-%v", pira.Name, "redis-ca"),
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: data,
+	}
 }
 
+// RedisService is the address PodInfo connects to Redis on. In the replicated and sentinel
+// modes, it only selects the node pod labelled as the primary.
 func (pira *PodInfoRedisApplication) RedisService() *corev1.Service {
+	selector := pira.labels("redis")
+	if pira.Spec.Redis.Mode.Replicated() {
+		selector[RedisRoleLabel] = RedisRolePrimary
+	}
 	return &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: pira.Namespace,
@@ -152,34 +1326,56 @@ func (pira *PodInfoRedisApplication) RedisService() *corev1.Service {
 		},
 		Spec: corev1.ServiceSpec{
 			Type:     corev1.ServiceTypeClusterIP,
-			Selector: pira.labels("redis"),
+			Selector: selector,
 			Ports: []corev1.ServicePort{{
-				Name:       "redis",
-				Port:       6379,
-				Protocol:   corev1.ProtocolTCP,
-				TargetPort: intstr.FromString("redis"),
+				Name:        "redis",
+				Port:        6379,
+				Protocol:    corev1.ProtocolTCP,
+				AppProtocol: lo.ToPtr(lo.Ternary(pira.Spec.Redis.TLS.Enabled, "rediss", "redis")),
+				TargetPort:  intstr.FromString("redis"),
 			}},
 		},
 	}
 }
 
+// LabelApplication names the component, such as podinfo or redis, an object belongs to.
+var LabelApplication = fmt.Sprintf("%v/Application", GroupVersion.Group)
+
+// LabelTrack tells the stable PodInfo pods from the canary ones during a progressive rollout.
+var LabelTrack = fmt.Sprintf("%v/track", GroupVersion.Group)
+
+// Tracks of the PodInfo pods.
+const (
+	TrackStable = "stable"
+	TrackCanary = "canary"
+)
+
+// PodInfoImage returns the PodInfo image the spec asks for.
+func (pira *PodInfoRedisApplication) PodInfoImage() string {
+	return fmt.Sprintf("%v:%v", pira.Spec.Image.Repository, pira.Spec.Image.Tag)
+}
+
 func (pira *PodInfoRedisApplication) PodInfoDeployment() *appsv1.Deployment {
-	return &appsv1.Deployment{
+	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: pira.Namespace,
 			Name:      fmt.Sprintf("%v-%v", pira.Name, "podinfo"),
 		},
 		Spec: appsv1.DeploymentSpec{
-			Replicas: pira.Spec.ReplicaCount,
-			Selector: &metav1.LabelSelector{MatchLabels: pira.labels("podinfo")},
+			// Left unset while autoscaling, so applying the Deployment doesn't undo the HorizontalPodAutoscaler.
+			Replicas:                lo.Ternary(pira.Spec.Autoscaling.Enabled, nil, pira.Spec.ReplicaCount),
+			Selector:                &metav1.LabelSelector{MatchLabels: pira.labels("podinfo")},
+			Strategy:                pira.Spec.Rollout.strategy(),
+			MinReadySeconds:         pira.Spec.Rollout.MinReadySeconds,
+			ProgressDeadlineSeconds: pira.Spec.Rollout.ProgressDeadlineSeconds,
+			RevisionHistoryLimit:    pira.Spec.Rollout.RevisionHistoryLimit,
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{Labels: pira.labels("podinfo")},
 				Spec: corev1.PodSpec{
 					Containers: []corev1.Container{
 						{
-							// TODO configure: liveness/readiness probes, Deployment strategy, PDBs, minready, etc
 							Name:  "podinfo",
-							Image: fmt.Sprintf("%v:%v", pira.Spec.Image.Repository, pira.Spec.Image.Tag),
+							Image: pira.PodInfoImage(),
 							Resources: corev1.ResourceRequirements{
 								Limits: corev1.ResourceList{
 									corev1.ResourceMemory: pira.Spec.MemoryLimit,
@@ -189,20 +1385,7 @@ func (pira *PodInfoRedisApplication) PodInfoDeployment() *appsv1.Deployment {
 								},
 							},
 							Command: []string{"./podinfo", "--port=9898"}, // hardcoding port for now. generate ports dynamically to avoid overlap?
-							Env: []corev1.EnvVar{
-								{
-									Name:  "PODINFO_UI_COLOR",
-									Value: pira.Spec.UI.Color,
-								},
-								{
-									Name:  "PODINFO_UI_MESSAGE",
-									Value: pira.Spec.UI.Message,
-								},
-								{
-									Name:  "PODINFO_CACHE_SERVER",
-									Value: fmt.Sprintf("tcp://%v-redis:6379", pira.Name),
-								},
-							},
+							Env:     pira.podInfoEnv(),
 							Ports: []corev1.ContainerPort{
 								{
 									Name:          "podinfo",
@@ -210,12 +1393,81 @@ func (pira *PodInfoRedisApplication) PodInfoDeployment() *appsv1.Deployment {
 									Protocol:      corev1.ProtocolTCP,
 								},
 							},
+							LivenessProbe: pira.Spec.Probes.Liveness.build(corev1.Probe{
+								ProbeHandler:     podInfoHTTPGet("/healthz"),
+								PeriodSeconds:    10,
+								TimeoutSeconds:   2,
+								SuccessThreshold: 1,
+								FailureThreshold: 3,
+							}),
+							ReadinessProbe: pira.Spec.Probes.Readiness.build(corev1.Probe{
+								ProbeHandler:     podInfoHTTPGet("/readyz"),
+								PeriodSeconds:    5,
+								TimeoutSeconds:   2,
+								SuccessThreshold: 1,
+								FailureThreshold: 3,
+							}),
+							// Gives PodInfo up to a minute to start before liveness checks begin.
+							StartupProbe: pira.Spec.Probes.Startup.build(corev1.Probe{
+								ProbeHandler:     podInfoHTTPGet("/healthz"),
+								PeriodSeconds:    2,
+								TimeoutSeconds:   2,
+								SuccessThreshold: 1,
+								FailureThreshold: 30,
+							}),
 						},
 					},
 				},
 			},
 		},
 	}
+
+	if pira.Spec.Redis.Enabled && pira.Spec.Redis.TLS.Enabled {
+		// Only the CA certificate is mounted, which PodInfo trusts through SSL_CERT_FILE.
+		podSpec := &deployment.Spec.Template.Spec
+		podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      "redis-tls",
+			MountPath: "/etc/podinfo/redis-tls",
+			ReadOnly:  true,
+		})
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: "redis-tls",
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+				SecretName: pira.RedisTLSSecretName(),
+				Items:      []corev1.KeyToPath{{Key: "ca.crt", Path: "ca.crt"}},
+			}},
+		})
+	}
+	if pira.Spec.Rollout.Progressive != nil {
+		// Leaves out the pods of the canary, which are owned by its own Deployment.
+		deployment.Spec.Selector.MatchExpressions = []metav1.LabelSelectorRequirement{{
+			Key:      LabelTrack,
+			Operator: metav1.LabelSelectorOpNotIn,
+			Values:   []string{TrackCanary},
+		}}
+		deployment.Spec.Template.Labels[LabelTrack] = TrackStable
+	}
+	return deployment
+}
+
+// PodInfoCanaryDeployment returns the Deployment a new PodInfo image is rolled out through.
+// Its selector and the stable one's don't overlap, while the PodInfo Service selects both.
+func (pira *PodInfoRedisApplication) PodInfoCanaryDeployment() *appsv1.Deployment {
+	deployment := pira.PodInfoDeployment()
+	deployment.Name = fmt.Sprintf("%v-%v", pira.Name, "podinfo-canary")
+	deployment.Spec.Selector = &metav1.LabelSelector{MatchLabels: lo.Assign(pira.labels("podinfo"), map[string]string{LabelTrack: TrackCanary})}
+	deployment.Spec.Template.Labels[LabelTrack] = TrackCanary
+	return deployment
+}
+
+// PodInfoTrackService returns the Service selecting only the PodInfo pods of track, which the
+// HTTPRoute splits traffic between, and the canary is checked through.
+func (pira *PodInfoRedisApplication) PodInfoTrackService(track string) *corev1.Service {
+	service := pira.PodInfoService()
+	service.Name = fmt.Sprintf("%v-podinfo-%v", pira.Name, track)
+	service.Spec.Type = corev1.ServiceTypeClusterIP
+	service.Spec.Selector = lo.Assign(service.Spec.Selector, map[string]string{LabelTrack: track})
+	return service
 }
 
 func (pira *PodInfoRedisApplication) PodInfoService() *corev1.Service {
@@ -225,7 +1477,7 @@ func (pira *PodInfoRedisApplication) PodInfoService() *corev1.Service {
 			Name:      fmt.Sprintf("%v-%v", pira.Name, "podinfo"),
 		},
 		Spec: corev1.ServiceSpec{
-			Type:     corev1.ServiceTypeNodePort,
+			Type:     lo.Ternary(pira.Spec.Expose.ServiceType == "", corev1.ServiceTypeNodePort, pira.Spec.Expose.ServiceType),
 			Selector: pira.labels("podinfo"),
 			Ports: []corev1.ServicePort{
 				{
@@ -238,9 +1490,167 @@ func (pira *PodInfoRedisApplication) PodInfoService() *corev1.Service {
 	}
 }
 
+func (pira *PodInfoRedisApplication) PodInfoIngress() *networkingv1.Ingress {
+	ingress := pira.Spec.Expose.Ingress
+	name := fmt.Sprintf("%v-%v", pira.Name, "podinfo")
+	var tls []networkingv1.IngressTLS
+	if ingress.TLSSecretName != "" {
+		tls = []networkingv1.IngressTLS{{Hosts: []string{ingress.Host}, SecretName: ingress.TLSSecretName}}
+	}
+	return &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   pira.Namespace,
+			Name:        name,
+			Annotations: ingress.Annotations,
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: ingress.ClassName,
+			TLS:              tls,
+			Rules: []networkingv1.IngressRule{{
+				Host: ingress.Host,
+				IngressRuleValue: networkingv1.IngressRuleValue{
+					HTTP: &networkingv1.HTTPIngressRuleValue{
+						Paths: []networkingv1.HTTPIngressPath{{
+							Path:     ingress.path(),
+							PathType: lo.ToPtr(networkingv1.PathTypePrefix),
+							Backend: networkingv1.IngressBackend{
+								Service: &networkingv1.IngressServiceBackend{
+									Name: name,
+									Port: networkingv1.ServiceBackendPort{Name: "podinfo"},
+								},
+							},
+						}},
+					},
+				},
+			}},
+		},
+	}
+}
+
+func (pira *PodInfoRedisApplication) PodInfoHTTPRoute() *gatewayv1.HTTPRoute {
+	route := pira.Spec.Expose.HTTPRoute
+	name := fmt.Sprintf("%v-%v", pira.Name, "podinfo")
+	return &gatewayv1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   pira.Namespace,
+			Name:        name,
+			Annotations: route.Annotations,
+		},
+		Spec: gatewayv1.HTTPRouteSpec{
+			CommonRouteSpec: gatewayv1.CommonRouteSpec{ParentRefs: route.ParentRefs},
+			Hostnames:       []gatewayv1.Hostname{gatewayv1.Hostname(route.Host)},
+			Rules: []gatewayv1.HTTPRouteRule{{
+				Matches: []gatewayv1.HTTPRouteMatch{{
+					Path: &gatewayv1.HTTPPathMatch{
+						Type:  lo.ToPtr(gatewayv1.PathMatchPathPrefix),
+						Value: lo.ToPtr(route.path()),
+					},
+				}},
+				BackendRefs: []gatewayv1.HTTPBackendRef{{
+					BackendRef: gatewayv1.BackendRef{
+						BackendObjectReference: gatewayv1.BackendObjectReference{
+							Name: gatewayv1.ObjectName(name),
+							Port: lo.ToPtr(gatewayv1.PortNumber(9898)),
+						},
+					},
+				}},
+			}},
+		},
+	}
+}
+
+func (pira *PodInfoRedisApplication) PodInfoHorizontalPodAutoscaler() *autoscalingv2.HorizontalPodAutoscaler {
+	autoscaling := pira.Spec.Autoscaling
+	var metrics []autoscalingv2.MetricSpec
+	for _, target := range []struct {
+		resource    corev1.ResourceName
+		utilization *int32
+	}{{corev1.ResourceCPU, autoscaling.TargetCPUUtilizationPercentage}, {corev1.ResourceMemory, autoscaling.TargetMemoryUtilizationPercentage}} {
+		if target.utilization == nil {
+			continue
+		}
+		metrics = append(metrics, autoscalingv2.MetricSpec{
+			Type: autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricSource{
+				Name: target.resource,
+				Target: autoscalingv2.MetricTarget{
+					Type:               autoscalingv2.UtilizationMetricType,
+					AverageUtilization: target.utilization,
+				},
+			},
+		})
+	}
+
+	name := fmt.Sprintf("%v-%v", pira.Name, "podinfo")
+	return &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: pira.Namespace,
+			Name:      name,
+		},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+				APIVersion: appsv1.SchemeGroupVersion.String(),
+				Kind:       "Deployment",
+				Name:       name,
+			},
+			MinReplicas: autoscaling.MinReplicas,
+			MaxReplicas: autoscaling.MaxReplicas,
+			Metrics:     metrics,
+			Behavior:    autoscaling.Behavior,
+		},
+	}
+}
+
+func (pira *PodInfoRedisApplication) PodInfoPodDisruptionBudget() *policyv1.PodDisruptionBudget {
+	return pira.podDisruptionBudget("podinfo")
+}
+
+func (pira *PodInfoRedisApplication) RedisPodDisruptionBudget() *policyv1.PodDisruptionBudget {
+	return pira.podDisruptionBudget("redis")
+}
+
+func (pira *PodInfoRedisApplication) podDisruptionBudget(application string) *policyv1.PodDisruptionBudget {
+	return &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: pira.Namespace,
+			Name:      fmt.Sprintf("%v-%v", pira.Name, application),
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			Selector:       &metav1.LabelSelector{MatchLabels: pira.labels(application)},
+			MinAvailable:   pira.Spec.DisruptionBudget.MinAvailable,
+			MaxUnavailable: pira.Spec.DisruptionBudget.MaxUnavailable,
+		},
+	}
+}
+
+func podInfoHTTPGet(path string) corev1.ProbeHandler {
+	return corev1.ProbeHandler{
+		HTTPGet: &corev1.HTTPGetAction{
+			Path: path,
+			Port: intstr.FromString("podinfo"),
+		},
+	}
+}
+
+// build returns base with the fields set on p overriding it.
+func (p *Probe) build(base corev1.Probe) *corev1.Probe {
+	if p == nil {
+		return &base
+	}
+	if p.Path != "" {
+		base.HTTPGet.Path = p.Path
+	}
+	base.InitialDelaySeconds = lo.FromPtrOr(p.InitialDelaySeconds, base.InitialDelaySeconds)
+	base.PeriodSeconds = lo.FromPtrOr(p.PeriodSeconds, base.PeriodSeconds)
+	base.TimeoutSeconds = lo.FromPtrOr(p.TimeoutSeconds, base.TimeoutSeconds)
+	base.SuccessThreshold = lo.FromPtrOr(p.SuccessThreshold, base.SuccessThreshold)
+	base.FailureThreshold = lo.FromPtrOr(p.FailureThreshold, base.FailureThreshold)
+	return &base
+}
+
 func (pira *PodInfoRedisApplication) labels(application string) map[string]string {
 	return map[string]string{
 		fmt.Sprintf("%v/%v", GroupVersion.Group, reflect.TypeOf(pira).Elem().Name()): string(pira.UID),
-		fmt.Sprintf("%v/Application", GroupVersion.Group):                            application,
+		LabelApplication: application,
 	}
 }
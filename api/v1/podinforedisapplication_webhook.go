@@ -0,0 +1,340 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/samber/lo"
+	"gopkg.in/inf.v0"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// AnnotationDefaulted lists the spec fields the defaulting webhook has filled in.
+var AnnotationDefaulted = fmt.Sprintf("%v/defaulted", GroupVersion.Group)
+
+// Defaults applied to fields left empty in a PodInfoRedisApplication spec.
+const (
+	DefaultImageRepository = "ghcr.io/stefanprodan/podinfo"
+	// DefaultImageTag is a known-good PodInfo release, used instead of a moving latest tag.
+	DefaultImageTag = "6.5.4"
+	DefaultUIColor  = "#34577c"
+
+	DefaultRedisImageRepository = "public.ecr.aws/docker/library/redis"
+	// DefaultRedisImageTag is a known-good Redis release, used instead of a moving latest tag.
+	DefaultRedisImageTag = "7.2.4"
+)
+
+var (
+	defaultCpuRequest  = resource.MustParse("100m")
+	defaultMemoryLimit = resource.MustParse("64Mi")
+
+	// hexColor matches CSS-style hex colors such as #fff or #34577c.
+	hexColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+	// managedRedisDirectives are redis.conf directives the operator sets on the command line,
+	// besides those starting with tls-. save and appendonly follow spec.redis.persistence.
+	managedRedisDirectives = sets.New("port", "requirepass", "dir", "include", "save", "appendonly")
+	// memoryPerCPU is the smallest memoryLimit PodInfo is allowed per requested CPU core.
+	memoryPerCPU = resource.MustParse("128Mi")
+)
+
+// SetupWebhookWithManager registers the PodInfoRedisApplication webhooks with the manager.
+func (pira *PodInfoRedisApplication) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(pira).
+		WithDefaulter(&podInfoRedisApplicationDefaulter{}).
+		WithValidator(&podInfoRedisApplicationValidator{}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-app-neeraj-angi-v1-podinforedisapplication,mutating=true,failurePolicy=fail,sideEffects=None,groups=app.neeraj.angi,resources=podinforedisapplication,verbs=create;update,versions=v1,name=mpodinforedisapplication.kb.io,admissionReviewVersions=v1
+
+// podInfoRedisApplicationDefaulter fills in fields that would otherwise produce an unusable
+// image reference or zero resource quantities.
+type podInfoRedisApplicationDefaulter struct{}
+
+var _ admission.CustomDefaulter = &podInfoRedisApplicationDefaulter{}
+
+func (d *podInfoRedisApplicationDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	pira, ok := obj.(*PodInfoRedisApplication)
+	if !ok {
+		return fmt.Errorf("expected a PodInfoRedisApplication but got %T", obj)
+	}
+	pira.setDefaults()
+	return nil
+}
+
+// setDefaults fills in empty spec fields and records their paths in the AnnotationDefaulted
+// annotation, alongside any recorded by earlier admissions.
+func (pira *PodInfoRedisApplication) setDefaults() {
+	defaulted := sets.New[string]()
+	if v, ok := pira.Annotations[AnnotationDefaulted]; ok && v != "" {
+		defaulted.Insert(strings.Split(v, ",")...)
+	}
+	applied := defaulted.Len()
+
+	if pira.Spec.Image.Repository == "" {
+		pira.Spec.Image.Repository = DefaultImageRepository
+		defaulted.Insert("spec.image.repository")
+	}
+	if pira.Spec.Image.Tag == "" {
+		pira.Spec.Image.Tag = DefaultImageTag
+		defaulted.Insert("spec.image.tag")
+	}
+	if pira.Spec.Resources.CpuRequest.IsZero() {
+		pira.Spec.Resources.CpuRequest = defaultCpuRequest.DeepCopy()
+		defaulted.Insert("spec.resources.cpuRequest")
+	}
+	if pira.Spec.Resources.MemoryLimit.IsZero() {
+		// Keep the default within what the validating webhook allows for the CPU request.
+		pira.Spec.Resources.MemoryLimit = defaultMemoryLimit.DeepCopy()
+		if minimum := minimumMemory(pira.Spec.Resources.CpuRequest); minimum.Cmp(defaultMemoryLimit) > 0 {
+			pira.Spec.Resources.MemoryLimit = minimum
+		}
+		defaulted.Insert("spec.resources.memoryLimit")
+	}
+	if pira.Spec.UI.Color == "" {
+		pira.Spec.UI.Color = DefaultUIColor
+		defaulted.Insert("spec.ui.color")
+	}
+	if image := &pira.Spec.Redis.Image; pira.Spec.Redis.Enabled {
+		if image.Repository == "" {
+			image.Repository = DefaultRedisImageRepository
+			defaulted.Insert("spec.redis.image.repository")
+		}
+		// A digest alone already pins the image.
+		if image.Tag == "" && image.Digest == "" {
+			image.Tag = DefaultRedisImageTag
+			defaulted.Insert("spec.redis.image.tag")
+		}
+	}
+
+	if defaulted.Len() > applied {
+		if pira.Annotations == nil {
+			pira.Annotations = map[string]string{}
+		}
+		pira.Annotations[AnnotationDefaulted] = strings.Join(sets.List(defaulted), ",")
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-app-neeraj-angi-v1-podinforedisapplication,mutating=false,failurePolicy=fail,sideEffects=None,groups=app.neeraj.angi,resources=podinforedisapplication,verbs=create;update,versions=v1,name=vpodinforedisapplication.kb.io,admissionReviewVersions=v1
+
+// podInfoRedisApplicationValidator rejects specs that would otherwise become broken Deployments.
+type podInfoRedisApplicationValidator struct{}
+
+var _ admission.CustomValidator = &podInfoRedisApplicationValidator{}
+
+func (v *podInfoRedisApplicationValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	pira, ok := obj.(*PodInfoRedisApplication)
+	if !ok {
+		return nil, fmt.Errorf("expected a PodInfoRedisApplication but got %T", obj)
+	}
+	return nil, pira.invalid(pira.validateSpec())
+}
+
+func (v *podInfoRedisApplicationValidator) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	pira, ok := newObj.(*PodInfoRedisApplication)
+	if !ok {
+		return nil, fmt.Errorf("expected a PodInfoRedisApplication but got %T", newObj)
+	}
+	old, ok := oldObj.(*PodInfoRedisApplication)
+	if !ok {
+		return nil, fmt.Errorf("expected a PodInfoRedisApplication but got %T", oldObj)
+	}
+	// An application admitted before a rule was added must still be able to have its finalizer
+	// removed, or its metadata changed, without first fixing its spec.
+	if !pira.DeletionTimestamp.IsZero() || equality.Semantic.DeepEqual(old.Spec, pira.Spec) {
+		return nil, nil
+	}
+	return nil, pira.invalid(append(pira.validateSpec(), pira.validateImmutable(old)...))
+}
+
+func (v *podInfoRedisApplicationValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// invalid wraps errs in an Invalid status error, or returns nil if there are none.
+func (pira *PodInfoRedisApplication) invalid(errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("PodInfoRedisApplication").GroupKind(), pira.Name, errs)
+}
+
+func (pira *PodInfoRedisApplication) validateSpec() field.ErrorList {
+	var errs field.ErrorList
+	spec := field.NewPath("spec")
+
+	if pira.Spec.Image.Repository == "" {
+		errs = append(errs, field.Required(spec.Child("image", "repository"), "an image repository is required"))
+	}
+
+	if color := pira.Spec.UI.Color; color != "" && !hexColor.MatchString(color) {
+		errs = append(errs, field.Invalid(spec.Child("ui", "color"), color, "must be a hex color such as #34577c"))
+	}
+
+	resources := spec.Child("resources")
+	if pira.Spec.Resources.CpuRequest.Sign() < 0 {
+		errs = append(errs, field.Invalid(resources.Child("cpuRequest"), pira.Spec.Resources.CpuRequest.String(), "must not be negative"))
+	}
+	if pira.Spec.Resources.MemoryLimit.Sign() < 0 {
+		errs = append(errs, field.Invalid(resources.Child("memoryLimit"), pira.Spec.Resources.MemoryLimit.String(), "must not be negative"))
+	} else if minimum := minimumMemory(pira.Spec.Resources.CpuRequest); !pira.Spec.Resources.MemoryLimit.IsZero() && pira.Spec.Resources.MemoryLimit.Cmp(minimum) < 0 {
+		errs = append(errs, field.Invalid(resources.Child("memoryLimit"), pira.Spec.Resources.MemoryLimit.String(),
+			fmt.Sprintf("must be at least %v per requested CPU (%v for a cpuRequest of %v)", memoryPerCPU.String(), minimum.String(), pira.Spec.Resources.CpuRequest.String())))
+	}
+
+	if db := pira.Spec.DisruptionBudget; db.MinAvailable != nil && db.MaxUnavailable != nil {
+		errs = append(errs, field.Forbidden(spec.Child("disruptionBudget", "maxUnavailable"), "may not be set together with minAvailable"))
+	}
+
+	if rollout := pira.Spec.Rollout; rollout.Strategy == appsv1.RecreateDeploymentStrategyType {
+		path := spec.Child("rollout")
+		if rollout.MaxSurge != nil {
+			errs = append(errs, field.Forbidden(path.Child("maxSurge"), "may not be set together with the Recreate strategy"))
+		}
+		if rollout.MaxUnavailable != nil {
+			errs = append(errs, field.Forbidden(path.Child("maxUnavailable"), "may not be set together with the Recreate strategy"))
+		}
+	}
+	if rollout := pira.Spec.Rollout; rollout.ProgressDeadlineSeconds != nil && *rollout.ProgressDeadlineSeconds <= rollout.MinReadySeconds {
+		errs = append(errs, field.Invalid(spec.Child("rollout", "progressDeadlineSeconds"), *rollout.ProgressDeadlineSeconds,
+			fmt.Sprintf("must be greater than minReadySeconds (%v)", rollout.MinReadySeconds)))
+	}
+
+	if progressive := pira.Spec.Rollout.Progressive; progressive != nil {
+		path := spec.Child("rollout", "progressive")
+		if progressive.Strategy == ProgressiveStrategyBlueGreen && len(progressive.Steps) > 0 {
+			errs = append(errs, field.Forbidden(path.Child("steps"), "may not be set together with the BlueGreen strategy"))
+		}
+		for i := 1; i < len(progressive.Steps); i++ {
+			if progressive.Steps[i] <= progressive.Steps[i-1] {
+				errs = append(errs, field.Invalid(path.Child("steps").Index(i), progressive.Steps[i], "must be greater than the previous step"))
+			}
+		}
+		if pira.Spec.Rollout.AutoRollback != nil {
+			errs = append(errs, field.Forbidden(spec.Child("rollout", "autoRollback"), "may not be set together with progressive, which rolls back canaries itself"))
+		}
+		if progressive.TrafficRouting == TrafficRoutingGatewayWeight && pira.Spec.Expose.HTTPRoute == nil {
+			errs = append(errs, field.Required(spec.Child("expose", "httpRoute"), "is required to route traffic by Gateway weights"))
+		}
+		if pira.Spec.Autoscaling.Enabled {
+			errs = append(errs, field.Forbidden(spec.Child("autoscaling", "enabled"), "may not be set together with progressive, as the autoscaler would undo the replicas the canary takes from the stable Deployment"))
+		}
+	}
+
+	if autoscaling := pira.Spec.Autoscaling; autoscaling.Enabled {
+		path := spec.Child("autoscaling")
+		if autoscaling.MaxReplicas == 0 {
+			errs = append(errs, field.Required(path.Child("maxReplicas"), "required when autoscaling is enabled"))
+		} else if minReplicas := lo.FromPtrOr(autoscaling.MinReplicas, 1); autoscaling.MaxReplicas < minReplicas {
+			errs = append(errs, field.Invalid(path.Child("maxReplicas"), autoscaling.MaxReplicas, fmt.Sprintf("must not be less than minReplicas (%v)", minReplicas)))
+		}
+	}
+
+	if pira.Spec.Expose.Ingress != nil && pira.Spec.Expose.HTTPRoute != nil {
+		errs = append(errs, field.Forbidden(spec.Child("expose", "httpRoute"), "may not be set together with ingress"))
+	}
+
+	if external := pira.Spec.Redis.External; external != nil {
+		path := spec.Child("redis", "external")
+		if pira.Spec.Redis.Enabled {
+			errs = append(errs, field.Forbidden(path, "may not be set together with enabled"))
+		}
+		if host, port, err := net.SplitHostPort(external.Address); err != nil || host == "" || port == "" {
+			errs = append(errs, field.Invalid(path.Child("address"), external.Address, "must be a host:port address"))
+		}
+	}
+
+	if sentinel := pira.Spec.Redis.Sentinel; pira.Spec.Redis.Mode == RedisModeSentinel {
+		// A quorum no set of Sentinels can reach would never fail over.
+		replicas, quorum := lo.FromPtrOr(sentinel.Replicas, 3), lo.FromPtrOr(sentinel.Quorum, 2)
+		if quorum > replicas {
+			errs = append(errs, field.Invalid(spec.Child("redis", "sentinel", "quorum"), quorum, fmt.Sprintf("must not exceed replicas (%v)", replicas)))
+		}
+	}
+
+	config := spec.Child("redis", "config")
+	keys := lo.Keys(pira.Spec.Redis.Config)
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := pira.Spec.Redis.Config[key]
+		switch {
+		case managedRedisDirectives.Has(strings.ToLower(key)) || strings.HasPrefix(strings.ToLower(key), "tls-"):
+			errs = append(errs, field.Forbidden(config.Key(key), "is managed by the operator"))
+		case strings.ContainsAny(key, " \t\r\n") || key == "":
+			errs = append(errs, field.Invalid(config.Key(key), key, "must be a single directive name"))
+		case strings.ContainsAny(value, "\r\n"):
+			errs = append(errs, field.Invalid(config.Key(key), value, "must be a single line"))
+		}
+	}
+
+	probes := spec.Child("probes")
+	for _, probe := range []struct {
+		name string
+		*Probe
+	}{{"liveness", pira.Spec.Probes.Liveness}, {"startup", pira.Spec.Probes.Startup}} {
+		if probe.Probe != nil && probe.SuccessThreshold != nil && *probe.SuccessThreshold != 1 {
+			errs = append(errs, field.Invalid(probes.Child(probe.name, "successThreshold"), *probe.SuccessThreshold, "must be 1 for liveness and startup probes"))
+		}
+	}
+
+	return errs
+}
+
+// validateImmutable rejects changes to fields that can't be changed on the objects built from
+// them.
+func (pira *PodInfoRedisApplication) validateImmutable(old *PodInfoRedisApplication) field.ErrorList {
+	var errs field.ErrorList
+	persistence := field.NewPath("spec", "redis", "persistence")
+
+	// Redis without persistence keeps its data in memory, which the new StatefulSet's empty
+	// claim wouldn't carry over.
+	if old.Spec.Redis.Enabled && pira.Spec.Redis.Enabled && old.Spec.Redis.Persistence == nil && pira.Spec.Redis.Persistence != nil {
+		errs = append(errs, field.Forbidden(persistence, "may not be enabled while Redis is running without it; disable Redis first"))
+	}
+	// The claim is created from the StatefulSet's volumeClaimTemplates, which are immutable.
+	if oldP, newP := old.Spec.Redis.Persistence, pira.Spec.Redis.Persistence; old.Spec.Redis.Enabled && pira.Spec.Redis.Enabled && oldP != nil && newP != nil {
+		if lo.FromPtr(oldP.StorageClassName) != lo.FromPtr(newP.StorageClassName) {
+			errs = append(errs, field.Forbidden(persistence.Child("storageClassName"), "may not be changed while persistence is enabled"))
+		}
+		if oldP.Size.Cmp(newP.Size) != 0 {
+			errs = append(errs, field.Forbidden(persistence.Child("size"), "may not be changed while persistence is enabled"))
+		}
+	}
+	return errs
+}
+
+// minimumMemory is the smallest memoryLimit allowed for the given cpuRequest, rounded up to
+// a whole byte.
+func minimumMemory(cpu resource.Quantity) resource.Quantity {
+	minimum := new(inf.Dec).Mul(cpu.AsDec(), memoryPerCPU.AsDec())
+	return *resource.NewDecimalQuantity(*minimum.Round(minimum, 0, inf.RoundCeil), resource.BinarySI)
+}
@@ -0,0 +1,301 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+var _ = Describe("PodInfoRedisApplication Webhook", func() {
+	var pira *PodInfoRedisApplication
+
+	BeforeEach(func() {
+		pira = &PodInfoRedisApplication{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "webhook-app",
+			},
+			Spec: PodInfoRedisApplicationSpec{
+				ReplicaCount: lo.ToPtr(int32(2)),
+				Resources: Resources{
+					MemoryLimit: resource.MustParse("64Mi"),
+					CpuRequest:  resource.MustParse("100m"),
+				},
+				Image: Image{
+					Repository: "ghcr.io/stefanprodan/podinfo",
+					Tag:        "6.5.4",
+				},
+				UI: UI{
+					Color:   "#34577c",
+					Message: "hello world",
+				},
+			},
+		}
+	})
+
+	Context("When creating PodInfoRedisApplication under Defaulting Webhook", func() {
+		It("should fill in empty fields and record them", func() {
+			pira.Spec.Image = Image{}
+			pira.Spec.Resources = Resources{}
+			pira.Spec.UI.Color = ""
+			Expect(k8sClient.Create(ctx, pira)).To(Succeed())
+
+			Expect(pira.Spec.Image.Repository).To(Equal(DefaultImageRepository))
+			Expect(pira.Spec.Image.Tag).To(Equal(DefaultImageTag))
+			Expect(pira.Spec.Resources.CpuRequest).To(Equal(resource.MustParse("100m")))
+			Expect(pira.Spec.Resources.MemoryLimit).To(Equal(resource.MustParse("64Mi")))
+			Expect(pira.Spec.UI.Color).To(Equal(DefaultUIColor))
+			Expect(pira.Annotations).To(HaveKeyWithValue(AnnotationDefaulted,
+				"spec.image.repository,spec.image.tag,spec.resources.cpuRequest,spec.resources.memoryLimit,spec.ui.color"))
+			Expect(k8sClient.Delete(ctx, pira)).To(Succeed())
+		})
+
+		It("should pin the Redis image only while Redis is enabled", func() {
+			pira.Spec.Redis.Enabled = true
+			Expect(k8sClient.Create(ctx, pira)).To(Succeed())
+			Expect(pira.Spec.Redis.Image.String()).To(Equal(DefaultRedisImageRepository + ":" + DefaultRedisImageTag))
+			Expect(pira.Annotations).To(HaveKeyWithValue(AnnotationDefaulted, "spec.redis.image.repository,spec.redis.image.tag"))
+			Expect(k8sClient.Delete(ctx, pira)).To(Succeed())
+		})
+
+		It("should leave fields that are set alone", func() {
+			Expect(k8sClient.Create(ctx, pira)).To(Succeed())
+			Expect(pira.Spec.Image.Tag).To(Equal("6.5.4"))
+			Expect(pira.Annotations).NotTo(HaveKey(AnnotationDefaulted))
+			Expect(k8sClient.Delete(ctx, pira)).To(Succeed())
+		})
+
+		It("should raise the default memory limit to suit a large CPU request", func() {
+			pira.Spec.Resources = Resources{CpuRequest: resource.MustParse("2")}
+			Expect(k8sClient.Create(ctx, pira)).To(Succeed())
+			Expect(pira.Spec.Resources.MemoryLimit.Cmp(resource.MustParse("256Mi"))).To(Equal(0))
+			Expect(k8sClient.Delete(ctx, pira)).To(Succeed())
+		})
+	})
+
+	Context("When creating PodInfoRedisApplication under Validating Webhook", func() {
+		It("should admit a valid spec", func() {
+			Expect(k8sClient.Create(ctx, pira)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, pira)).To(Succeed())
+		})
+
+		It("should deny an empty image repository", func() {
+			// The defaulter fills in an empty repository before it reaches the validator through
+			// the API server, so the validator is called directly.
+			pira.Spec.Image.Repository = ""
+			_, err := (&podInfoRedisApplicationValidator{}).ValidateCreate(ctx, pira)
+			Expect(errors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.image.repository"))
+		})
+
+		It("should deny a UI color that is not a hex string", func() {
+			pira.Spec.UI.Color = "blue"
+			err := k8sClient.Create(ctx, pira)
+			Expect(errors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.ui.color"))
+		})
+
+		It("should deny a memory limit below the minimum for the CPU request", func() {
+			pira.Spec.Resources.CpuRequest = resource.MustParse("2")
+			pira.Spec.Resources.MemoryLimit = resource.MustParse("64Mi")
+			err := k8sClient.Create(ctx, pira)
+			Expect(errors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.resources.memoryLimit"))
+		})
+
+		It("should deny a disruption budget with both minAvailable and maxUnavailable", func() {
+			pira.Spec.DisruptionBudget = DisruptionBudget{
+				MinAvailable:   lo.ToPtr(intstr.FromInt32(1)),
+				MaxUnavailable: lo.ToPtr(intstr.FromString("50%")),
+			}
+			err := k8sClient.Create(ctx, pira)
+			Expect(errors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.disruptionBudget.maxUnavailable"))
+		})
+
+		It("should deny rolling update settings under the Recreate strategy", func() {
+			pira.Spec.Rollout = Rollout{
+				Strategy: appsv1.RecreateDeploymentStrategyType,
+				MaxSurge: lo.ToPtr(intstr.FromInt32(1)),
+			}
+			err := k8sClient.Create(ctx, pira)
+			Expect(errors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.rollout.maxSurge"))
+		})
+
+		It("should deny a progress deadline no longer than minReadySeconds", func() {
+			pira.Spec.Rollout = Rollout{MinReadySeconds: 30, ProgressDeadlineSeconds: lo.ToPtr(int32(30))}
+			err := k8sClient.Create(ctx, pira)
+			Expect(errors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.rollout.progressDeadlineSeconds"))
+		})
+
+		It("should deny canary steps that don't increase", func() {
+			pira.Spec.Rollout.Progressive = &ProgressiveRollout{Steps: []int32{50, 20}}
+			err := k8sClient.Create(ctx, pira)
+			Expect(errors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.rollout.progressive.steps[1]"))
+		})
+
+		It("should deny routing canary traffic by Gateway weights without an HTTPRoute", func() {
+			pira.Spec.Rollout.Progressive = &ProgressiveRollout{TrafficRouting: TrafficRoutingGatewayWeight}
+			err := k8sClient.Create(ctx, pira)
+			Expect(errors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.expose.httpRoute"))
+		})
+
+		It("should deny automatic rollback together with a progressive rollout", func() {
+			pira.Spec.Rollout.Progressive = &ProgressiveRollout{}
+			pira.Spec.Rollout.AutoRollback = &AutoRollback{}
+			err := k8sClient.Create(ctx, pira)
+			Expect(errors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.rollout.autoRollback"))
+		})
+
+		It("should deny autoscaling together with a progressive rollout", func() {
+			pira.Spec.Rollout.Progressive = &ProgressiveRollout{}
+			pira.Spec.Autoscaling = Autoscaling{Enabled: true, MaxReplicas: 5}
+			err := k8sClient.Create(ctx, pira)
+			Expect(errors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.autoscaling.enabled"))
+		})
+
+		It("should deny autoscaling with maxReplicas below minReplicas", func() {
+			pira.Spec.Autoscaling = Autoscaling{
+				Enabled:     true,
+				MinReplicas: lo.ToPtr(int32(3)),
+				MaxReplicas: 2,
+			}
+			err := k8sClient.Create(ctx, pira)
+			Expect(errors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.autoscaling.maxReplicas"))
+		})
+
+		It("should deny Redis config directives the operator manages", func() {
+			pira.Spec.Redis.Config = map[string]string{"maxmemory": "100mb", "requirepass": "hunter2", "tls-port": "6380", "save": "60 1", "appendonly": "yes"}
+			err := k8sClient.Create(ctx, pira)
+			Expect(errors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.redis.config[requirepass]"))
+			Expect(err.Error()).To(ContainSubstring("spec.redis.config[tls-port]"))
+			Expect(err.Error()).To(ContainSubstring("spec.redis.config[save]"))
+			Expect(err.Error()).To(ContainSubstring("spec.redis.config[appendonly]"))
+			Expect(err.Error()).NotTo(ContainSubstring("maxmemory"))
+		})
+
+		It("should deny a Sentinel quorum larger than the number of Sentinels", func() {
+			pira.Spec.Redis.Mode = RedisModeSentinel
+			pira.Spec.Redis.Sentinel = RedisSentinel{Replicas: lo.ToPtr(int32(3)), Quorum: lo.ToPtr(int32(4))}
+			err := k8sClient.Create(ctx, pira)
+			Expect(errors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.redis.sentinel.quorum"))
+		})
+
+		It("should deny an external Redis while Redis is enabled", func() {
+			pira.Spec.Redis.Enabled = true
+			pira.Spec.Redis.External = &ExternalRedis{Address: "redis.example.com"}
+			err := k8sClient.Create(ctx, pira)
+			Expect(errors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.redis.external: Forbidden"))
+			Expect(err.Error()).To(ContainSubstring("spec.redis.external.address"))
+		})
+
+		It("should deny exposing PodInfo through both an Ingress and an HTTPRoute", func() {
+			pira.Spec.Expose = Expose{
+				Ingress: &Ingress{Route: Route{Host: "podinfo.example.com"}},
+				HTTPRoute: &HTTPRoute{
+					Route:      Route{Host: "podinfo.example.com"},
+					ParentRefs: []gatewayv1.ParentReference{{Name: "gateway"}},
+				},
+			}
+			err := k8sClient.Create(ctx, pira)
+			Expect(errors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.expose.httpRoute"))
+		})
+	})
+
+	Context("When updating PodInfoRedisApplication under Validating Webhook", func() {
+		It("should deny an update that makes the spec invalid", func() {
+			Expect(k8sClient.Create(ctx, pira)).To(Succeed())
+			pira.Spec.UI.Color = "#12345g"
+			err := k8sClient.Update(ctx, pira)
+			Expect(errors.IsInvalid(err)).To(BeTrue())
+			Expect(k8sClient.Delete(ctx, pira)).To(Succeed())
+		})
+
+		It("should deny resizing persistent Redis storage", func() {
+			pira.Spec.Redis = Redis{
+				Enabled:     true,
+				Persistence: &Persistence{Size: resource.MustParse("1Gi")},
+			}
+			Expect(k8sClient.Create(ctx, pira)).To(Succeed())
+			pira.Spec.Redis.Persistence.Size = resource.MustParse("2Gi")
+			err := k8sClient.Update(ctx, pira)
+			Expect(errors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.redis.persistence.size"))
+			Expect(k8sClient.Delete(ctx, pira)).To(Succeed())
+		})
+
+		It("should deny enabling persistence on a running Redis", func() {
+			pira.Spec.Redis = Redis{Enabled: true}
+			Expect(k8sClient.Create(ctx, pira)).To(Succeed())
+			pira.Spec.Redis.Persistence = &Persistence{Size: resource.MustParse("1Gi")}
+			err := k8sClient.Update(ctx, pira)
+			Expect(errors.IsInvalid(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.redis.persistence"))
+
+			By("allowing it together with enabling Redis")
+			pira.Spec.Redis = Redis{}
+			Expect(k8sClient.Update(ctx, pira)).To(Succeed())
+			pira.Spec.Redis = Redis{Enabled: true, Persistence: &Persistence{Size: resource.MustParse("1Gi")}}
+			Expect(k8sClient.Update(ctx, pira)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, pira)).To(Succeed())
+		})
+
+		It("should admit removing the finalizer from an invalid application being deleted", func() {
+			// An application admitted before a rule was added can't be created through the API
+			// server, so the validator is called directly.
+			pira.Spec.UI.Color = "#12345g"
+			pira.Finalizers = []string{"app.neeraj.angi/cleanup"}
+			pira.DeletionTimestamp = lo.ToPtr(metav1.Now())
+			updated := pira.DeepCopy()
+			updated.Finalizers = nil
+			warnings, err := (&podInfoRedisApplicationValidator{}).ValidateUpdate(ctx, pira, updated)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(BeEmpty())
+
+			By("admitting a label change to one that isn't being deleted")
+			pira.DeletionTimestamp = nil
+			updated = pira.DeepCopy()
+			updated.Labels = map[string]string{"team": "web"}
+			_, err = (&podInfoRedisApplicationValidator{}).ValidateUpdate(ctx, pira, updated)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("still denying a spec change that leaves it invalid")
+			updated.Spec.UI.Message = "changed"
+			_, err = (&podInfoRedisApplicationValidator{}).ValidateUpdate(ctx, pira, updated)
+			Expect(errors.IsInvalid(err)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,265 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/samber/lo"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	v1 "neeraj.angi/app-operator/api/v1"
+)
+
+// Finalizer holds a PodInfoRedisApplication until the operator has torn it down according
+// to its deletionPolicy.
+var Finalizer = fmt.Sprintf("%v/cleanup", v1.GroupVersion.Group)
+
+// finalize tears pira down once it is being deleted, then removes its finalizer. Unless the
+// deletionPolicy is Orphan, PodInfo is scaled to zero first, so that it stops serving before
+// Redis goes away, and Redis then saves its dataset if asked to. The objects the policy keeps
+// are released from their owners, so the garbage collector leaves them behind, and the
+// others are deleted.
+func (r *PodInfoRedisApplicationReconciler) finalize(ctx context.Context, pira *v1.PodInfoRedisApplication) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(pira, Finalizer) {
+		return ctrl.Result{}, nil
+	}
+	policy := lo.Ternary(pira.Spec.DeletionPolicy == "", v1.DeletionPolicyRetain, pira.Spec.DeletionPolicy)
+	owned, err := r.ownedObjects(ctx, pira)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if policy == v1.DeletionPolicyOrphan {
+		for _, obj := range owned {
+			if err := r.release(ctx, pira, obj, isOwner(pira)); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, r.removeFinalizer(ctx, pira)
+	}
+
+	stopped, err := r.scaleDownPodInfo(ctx, pira, owned)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !stopped {
+		// The Deployment's status updates requeue pira; polling covers a missed one.
+		log.FromContext(ctx).Info("Waiting for PodInfo to scale down before deleting Redis")
+		return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+	}
+	if persistence := pira.Spec.Redis.Persistence; persistence != nil && persistence.SnapshotOnDelete && policy != v1.DeletionPolicyDelete {
+		r.snapshotRedis(ctx, pira, owned)
+	}
+
+	claims := &corev1.PersistentVolumeClaimList{}
+	if err := r.Client.List(ctx, claims, client.InNamespace(pira.Namespace), client.MatchingLabels(pira.RedisStatefulSet().Spec.Selector.MatchLabels)); err != nil {
+		return ctrl.Result{}, fmt.Errorf("listing Redis claims: %v", err)
+	}
+	for i := range claims.Items {
+		claim := &claims.Items[i]
+		if policy == v1.DeletionPolicyDelete {
+			if err := r.delete(ctx, pira, claim); err != nil {
+				return ctrl.Result{}, err
+			}
+			continue
+		}
+		// A StatefulSet whose retentionPolicy is Delete owns its claims; released first,
+		// they outlive it.
+		if err := r.release(ctx, pira, claim, isRedisStatefulSet(pira)); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	for _, obj := range owned {
+		if _, ok := obj.(*corev1.Secret); ok && policy == v1.DeletionPolicyRetain {
+			if err := r.release(ctx, pira, obj, isOwner(pira)); err != nil {
+				return ctrl.Result{}, err
+			}
+			continue
+		}
+		if err := r.delete(ctx, pira, obj, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{}, r.removeFinalizer(ctx, pira)
+}
+
+func (r *PodInfoRedisApplicationReconciler) removeFinalizer(ctx context.Context, pira *v1.PodInfoRedisApplication) error {
+	controllerutil.RemoveFinalizer(pira, Finalizer)
+	if err := r.Client.Update(ctx, pira); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("removing finalizer: %v", err)
+	}
+	forgetApplication(pira.Namespace, pira.Name)
+	return nil
+}
+
+// ownedObjects returns the live objects pira controls, in teardown order. Objects of the same
+// name that pira doesn't control, such as a user's Secret, are left out.
+func (r *PodInfoRedisApplicationReconciler) ownedObjects(ctx context.Context, pira *v1.PodInfoRedisApplication) ([]client.Object, error) {
+	var owned []client.Object
+	for _, obj := range ownedCandidates(pira) {
+		err := r.Client.Get(ctx, client.ObjectKeyFromObject(obj), obj)
+		// A missing kind means its CRD, such as the Gateway API's, isn't installed.
+		if client.IgnoreNotFound(err) != nil && !meta.IsNoMatchError(err) {
+			return nil, fmt.Errorf("getting: %v", err)
+		}
+		if err == nil && metav1.IsControlledBy(obj, pira) {
+			owned = append(owned, obj)
+		}
+	}
+	return owned, nil
+}
+
+// scaleDownPodInfo scales the PodInfo Deployments among owned, the stable one and any canary,
+// to zero, reporting whether their pods are gone.
+func (r *PodInfoRedisApplicationReconciler) scaleDownPodInfo(ctx context.Context, pira *v1.PodInfoRedisApplication, owned []client.Object) (bool, error) {
+	for _, obj := range owned {
+		if hpa, ok := obj.(*autoscalingv2.HorizontalPodAutoscaler); ok {
+			if err := r.delete(ctx, pira, hpa); err != nil {
+				return false, err
+			}
+		}
+	}
+	names := []string{pira.PodInfoDeployment().Name, pira.PodInfoCanaryDeployment().Name}
+	stopped := true
+	for _, obj := range owned {
+		deployment, ok := obj.(*appsv1.Deployment)
+		if !ok || !lo.Contains(names, deployment.Name) {
+			continue
+		}
+		if lo.FromPtr(deployment.Spec.Replicas) != 0 {
+			patch := client.MergeFrom(deployment.DeepCopy())
+			deployment.Spec.Replicas = lo.ToPtr(int32(0))
+			if err := r.Client.Patch(ctx, deployment, patch); err != nil {
+				r.Recorder.Eventf(pira, corev1.EventTypeWarning, "ScaleDownFailed", "Scaling down Deployment %v: %v", deployment.Name, err)
+				return false, fmt.Errorf("scaling down PodInfo: %v", err)
+			}
+			r.Recorder.Eventf(pira, corev1.EventTypeNormal, "ScaledDown", "Scaled Deployment %v to zero before deleting Redis", deployment.Name)
+		}
+		stopped = stopped && deployment.Status.Replicas == 0
+	}
+	return stopped, nil
+}
+
+// snapshotRedis has every Redis pod with a claim save its dataset to it. A failed snapshot is
+// reported in an event rather than blocking the deletion.
+func (r *PodInfoRedisApplicationReconciler) snapshotRedis(ctx context.Context, pira *v1.PodInfoRedisApplication, owned []client.Object) {
+	for _, obj := range owned {
+		sts, ok := obj.(*appsv1.StatefulSet)
+		if !ok || len(sts.Spec.VolumeClaimTemplates) == 0 {
+			continue
+		}
+		for i := int32(0); i < lo.FromPtrOr(sts.Spec.Replicas, 1); i++ {
+			pod := fmt.Sprintf("%v-%v", sts.Name, i)
+			// Node pods have DNS names of their own, while the single pod of a standalone Redis is
+			// reached through the Redis Service.
+			address := fmt.Sprintf("%v.%v.%v.svc:6379", pod, sts.Spec.ServiceName, pira.Namespace)
+			if sts.Name == pira.RedisStatefulSet().Name {
+				address = fmt.Sprintf("%v.%v.svc:6379", sts.Spec.ServiceName, pira.Namespace)
+			}
+			cmdCtx, cancel := context.WithTimeout(ctx, time.Minute)
+			_, err := r.redisCommand(cmdCtx, pira, address, "SAVE")
+			cancel()
+			if err != nil {
+				r.Recorder.Eventf(pira, corev1.EventTypeWarning, "SnapshotFailed", "Deleting Redis pod %v without a snapshot: %v", pod, err)
+				continue
+			}
+			log.FromContext(ctx).Info("Saved Redis snapshot", "pod", pod)
+		}
+	}
+}
+
+// release removes the owner references of obj that owner matches, so that the garbage
+// collector keeps obj once its owners are deleted, recording an event on pira.
+func (r *PodInfoRedisApplicationReconciler) release(ctx context.Context, pira *v1.PodInfoRedisApplication, obj client.Object, owner func(metav1.OwnerReference) bool) error {
+	refs := obj.GetOwnerReferences()
+	kept := lo.Reject(refs, func(ref metav1.OwnerReference, _ int) bool { return owner(ref) })
+	if len(kept) == len(refs) {
+		return nil
+	}
+	obj.SetOwnerReferences(kept)
+	err := r.Client.Update(ctx, obj)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		r.Recorder.Eventf(pira, corev1.EventTypeWarning, "ReleaseFailed", "Releasing %v %v: %v", r.kindOf(obj), obj.GetName(), err)
+		return fmt.Errorf("releasing %v: %v", obj.GetName(), err)
+	}
+	r.Recorder.Eventf(pira, corev1.EventTypeNormal, "Released", "Released %v %v, which outlives the application", r.kindOf(obj), obj.GetName())
+	return nil
+}
+
+func isOwner(pira *v1.PodInfoRedisApplication) func(metav1.OwnerReference) bool {
+	return func(ref metav1.OwnerReference) bool { return ref.UID == pira.UID }
+}
+
+func isRedisStatefulSet(pira *v1.PodInfoRedisApplication) func(metav1.OwnerReference) bool {
+	names := []string{pira.RedisStatefulSet().Name, pira.RedisNodeStatefulSet().Name}
+	return func(ref metav1.OwnerReference) bool {
+		return ref.Kind == "StatefulSet" && lo.Contains(names, ref.Name)
+	}
+}
+
+// ownedCandidates returns every object pira may control, in the order they are torn down:
+// the HorizontalPodAutoscaler first, so it doesn't scale PodInfo back up, and Secrets last.
+func ownedCandidates(pira *v1.PodInfoRedisApplication) []client.Object {
+	podInfo := metav1.ObjectMeta{Namespace: pira.Namespace, Name: pira.PodInfoDeployment().Name}
+	return append([]client.Object{
+		&autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: podInfo},
+		pira.PodInfoPodDisruptionBudget(),
+		&networkingv1.Ingress{ObjectMeta: podInfo},
+		&gatewayv1.HTTPRoute{ObjectMeta: podInfo},
+		&appsv1.Deployment{ObjectMeta: podInfo},
+		pira.PodInfoCanaryDeployment(),
+		pira.PodInfoService(),
+		pira.PodInfoTrackService(v1.TrackStable),
+		pira.PodInfoTrackService(v1.TrackCanary),
+	}, redisCandidates(pira)...)
+}
+
+// redisCandidates returns the objects of the managed Redis pira may control, along with the
+// Secret PodInfo reads the Redis password from, in the order they are torn down.
+func redisCandidates(pira *v1.PodInfoRedisApplication) []client.Object {
+	return []client.Object{
+		pira.RedisPodDisruptionBudget(),
+		pira.RedisDeployment(),
+		pira.RedisStatefulSet(),
+		pira.RedisNodeStatefulSet(),
+		pira.RedisSentinelStatefulSet(),
+		pira.RedisService(),
+		pira.RedisHeadlessService(),
+		pira.RedisSentinelService(),
+		pira.RedisConfigMap(),
+		pira.RedisAuthSecret(nil),
+		pira.PodInfoRedisPasswordSecret(nil),
+		pira.RedisTLSSecret(nil),
+		pira.RedisCASecret(nil),
+	}
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/samber/lo"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	v1 "neeraj.angi/app-operator/api/v1"
+)
+
+var (
+	driftCorrectionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "app_operator_drift_corrections_total",
+		Help: "Number of owned objects restored after being modified outside the operator.",
+	}, []string{"namespace", "name", "kind"})
+	hashMismatchesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "app_operator_hash_mismatches_total",
+		Help: "Number of owned objects updated because their hash annotation didn't match their desired state.",
+	}, []string{"namespace", "name", "kind"})
+	applyOperationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "app_operator_apply_operations_total",
+		Help: "Number of owned objects applied, by the write made, or error if the apply failed.",
+	}, []string{"namespace", "name", "kind", "result"})
+	applicationReady = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "app_operator_application_ready",
+		Help: "Whether the Ready condition of an application has the given status. Summed by status, the number of applications in each state.",
+	}, []string{"namespace", "name", "status"})
+	applicationRedisEnabled = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "app_operator_application_redis_enabled",
+		Help: "Whether an application runs a Redis managed by the operator. Summed, the number of Redis-enabled applications.",
+	}, []string{"namespace", "name"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(driftCorrectionsTotal, hashMismatchesTotal, applyOperationsTotal, applicationReady, applicationRedisEnabled)
+}
+
+// recordApplication sets the gauges describing pira from its spec and status.
+func recordApplication(pira *v1.PodInfoRedisApplication) {
+	ready := metav1.ConditionUnknown
+	if c := meta.FindStatusCondition(pira.Status.Conditions, v1.ConditionReady); c != nil {
+		ready = c.Status
+	}
+	for _, status := range []metav1.ConditionStatus{metav1.ConditionTrue, metav1.ConditionFalse, metav1.ConditionUnknown} {
+		applicationReady.WithLabelValues(pira.Namespace, pira.Name, string(status)).Set(lo.Ternary(status == ready, 1.0, 0.0))
+	}
+	applicationRedisEnabled.WithLabelValues(pira.Namespace, pira.Name).Set(lo.Ternary(pira.Spec.Redis.Enabled, 1.0, 0.0))
+}
+
+// forgetApplication removes every series of the application name in namespace, once it is
+// deleted.
+func forgetApplication(namespace, name string) {
+	labels := prometheus.Labels{"namespace": namespace, "name": name}
+	for _, vec := range []interface{ DeletePartialMatch(prometheus.Labels) int }{
+		driftCorrectionsTotal, hashMismatchesTotal, applyOperationsTotal, applicationReady, applicationRedisEnabled,
+	} {
+		vec.DeletePartialMatch(labels)
+	}
+}
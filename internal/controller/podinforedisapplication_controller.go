@@ -19,14 +19,33 @@ package controller
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/samber/lo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	apiv1 "neeraj.angi/app-operator/api/v1"
@@ -34,52 +53,484 @@ import (
 	"neeraj.angi/app-operator/util/kubeclient"
 )
 
+// TracerName names the tracer the reconciler records its spans with.
+const TracerName = "neeraj.angi/app-operator/internal/controller"
+
 // PodInfoRedisApplicationReconciler reconciles a PodInfoRedisApplication object
 type PodInfoRedisApplicationReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// ApplyOptions selects how owned objects are written to the cluster.
+	ApplyOptions kubeclient.Options
+	// RedisDialer connects to Sentinel to look up the Redis primary in the sentinel mode, and to
+	// Redis to snapshot it before it is deleted. Without one, a net.Dialer is used.
+	RedisDialer RedisDialer
+	// HealthChecker runs the HTTP check of canaries. Without one, /healthz is sent a GET.
+	HealthChecker HealthChecker
 }
 
 // +kubebuilder:rbac:groups=app.neeraj.angi,resources=podinforedisapplication,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=app.neeraj.angi,resources=podinforedisapplication/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=app.neeraj.angi,resources=podinforedisapplication/finalizers,verbs=update
-// +kubebuilder:rbac:groups="apps",resources=deployments,verbs=get;watch;list;create;update;delete
-// +kubebuilder:rbac:groups="",resources=service,verbs=get;watch;list;create;update;delete
-func (r *PodInfoRedisApplicationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups="apps",resources=deployments,verbs=get;watch;list;create;update;patch;delete
+// +kubebuilder:rbac:groups="apps",resources=statefulsets,verbs=get;watch;list;create;update;patch;delete
+// +kubebuilder:rbac:groups="apps",resources=replicasets,verbs=get;watch;list
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;watch;list;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=pods,verbs=patch
+// +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;watch;list;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;watch;list;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=services,verbs=get;watch;list;create;update;patch;delete
+// +kubebuilder:rbac:groups="autoscaling",resources=horizontalpodautoscalers,verbs=get;watch;list;create;update;patch;delete
+// +kubebuilder:rbac:groups="networking.k8s.io",resources=ingresses,verbs=get;watch;list;create;update;patch;delete
+// +kubebuilder:rbac:groups="gateway.networking.k8s.io",resources=httproutes,verbs=get;watch;list;create;update;patch;delete
+// +kubebuilder:rbac:groups="gateway.networking.k8s.io",resources=gateways,verbs=get;watch;list
+// +kubebuilder:rbac:groups="policy",resources=poddisruptionbudgets,verbs=get;watch;list;create;update;patch;delete
+func (r *PodInfoRedisApplicationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	ctx, span := otel.Tracer(TracerName).Start(ctx, "Reconcile", trace.WithAttributes(
+		attribute.String("k8s.namespace.name", req.Namespace),
+		attribute.String("app_operator.application", req.Name),
+	))
+	defer func() { kubeclient.EndSpan(span, "", err) }()
+
 	pira := &v1.PodInfoRedisApplication{}
 	if err := r.Client.Get(ctx, req.NamespacedName, pira); err != nil {
+		if errors.IsNotFound(err) {
+			forgetApplication(req.Namespace, req.Name)
+		}
 		return reconcile.Result{}, client.IgnoreNotFound(err)
 	}
-	objs := []client.Object{pira.PodInfoService(), pira.PodInfoDeployment()}
+	if !pira.DeletionTimestamp.IsZero() {
+		return r.finalize(ctx, pira)
+	}
+	if controllerutil.AddFinalizer(pira, Finalizer) {
+		if err := r.Client.Update(ctx, pira); err != nil {
+			return ctrl.Result{}, fmt.Errorf("adding finalizer: %v", err)
+		}
+	}
+
+	// Having been paused, the objects are applied again and what was overwritten reported.
+	resuming := !pira.Paused() && meta.IsStatusConditionTrue(pira.Status.Conditions, v1.ConditionPaused)
+	observed, err := r.reconcileResources(ctx, pira)
+	if resuming && err == nil {
+		r.recordResumed(pira, observed)
+	}
+	if statusErr := r.updateStatus(ctx, pira, observed, err); statusErr != nil && err == nil {
+		err = fmt.Errorf("updating status: %v", statusErr)
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: observed.requeueAfter}, nil
+}
+
+// reconcileResources applies the objects owned by pira and returns the live workloads,
+// whose status is reported back on pira. Objects of disabled components, left out of the
+// resource set, are pruned once the others are applied. Those of a disabled Redis are kept
+// until PodInfo has rolled out without it, so that no pod still configured with the cache
+// loses it. While pira is paused, nothing is applied and the workloads are only read.
+func (r *PodInfoRedisApplicationReconciler) reconcileResources(ctx context.Context, pira *v1.PodInfoRedisApplication) (*observedState, error) {
+	observed, objs, err := r.desiredResources(ctx, pira)
+	if err != nil {
+		return observed, err
+	}
+	if pira.Paused() {
+		return observed, r.observeLive(ctx, pira, observed)
+	}
+	if recreating, err := r.recreatePodInfo(ctx, pira, observed.podInfo); err != nil || recreating {
+		observed.requeueWithin(recreateCheckInterval)
+		return observed, err
+	}
+
+	for _, obj := range objs {
+		if err := controllerutil.SetControllerReference(pira, obj, r.Scheme); err != nil {
+			r.Recorder.Eventf(pira, corev1.EventTypeWarning, "OwnerRefFailed", "Setting owner reference on %v %v: %v", r.kindOf(obj), obj.GetName(), err)
+			return observed, fmt.Errorf("setting owner reference: %v", err)
+		}
+	}
+	inventory, err := r.inventory(pira)
+	if err != nil {
+		return observed, err
+	}
+	// Only an inventory recorded by an apply holds a Redis that PodInfo may be using, unlike one
+	// guessed for an application that hasn't been applied yet.
+	var redis []kubeclient.InventoryEntry
+	if !pira.Spec.Redis.Enabled && pira.Status.Inventory != nil {
+		if redis, err = r.redisInventory(pira, inventory); err != nil {
+			return observed, err
+		}
+		inventory = lo.Without(inventory, redis...)
+	}
+	observeApply := r.observeApply(pira)
+	observe := func(obj client.Object, result kubeclient.Result, err error) {
+		observeApply(obj, result, err)
+		if err == nil && (result == kubeclient.ResultUpdated || result == kubeclient.ResultDriftCorrected) {
+			observed.applied[result] = append(observed.applied[result], fmt.Sprintf("%v %v", r.kindOf(obj), obj.GetName()))
+		}
+	}
+	observed.inventory, err = kubeclient.ApplySet(ctx, r.Client, pira, objs, inventory, r.ApplyOptions, observe)
+	if err != nil {
+		observed.inventory = append(observed.inventory, redis...)
+		return observed, err
+	}
+	// Entries applied again, such as the Secret PodInfo reads the password of an external Redis
+	// from, are no longer held.
+	redis = lo.Without(redis, observed.inventory...)
+	if len(redis) > 0 && !podInfoRolledOut(observed) {
+		log.FromContext(ctx).Info("Waiting for PodInfo to roll out before deleting Redis")
+		observed.inventory = append(observed.inventory, redis...)
+		observed.requeueWithin(redisHandoverInterval)
+	} else if len(redis) > 0 {
+		left, err := kubeclient.Prune(ctx, r.Client, pira, redis, observe)
+		observed.inventory = append(observed.inventory, left...)
+		if err != nil {
+			return observed, err
+		}
+	}
+	if pira.Spec.Redis.Enabled && pira.Spec.Redis.Mode.Replicated() {
+		if err := r.reconcileRedisPrimary(ctx, pira, observed); err != nil {
+			return observed, err
+		}
+	}
+	return observed, nil
+}
+
+// desiredResources returns the objects owned by pira, in the order they are applied, along
+// with the observed state holding those of them whose status is reported.
+func (r *PodInfoRedisApplicationReconciler) desiredResources(ctx context.Context, pira *v1.PodInfoRedisApplication) (*observedState, []client.Object, error) {
+	observed := &observedState{applied: map[kubeclient.Result][]string{}, rollout: pira.Status.Rollout, autoRollback: pira.Status.AutoRollback, podInfo: pira.PodInfoDeployment(), podInfoService: pira.PodInfoService()}
+	objs := []client.Object{observed.podInfoService}
+	// Each Redis topology is made of some of these objects. The workloads of other topologies
+	// are pruned, as their pods would otherwise be selected by the Redis Services alongside
+	// the current ones.
+	redisConfig, redisService, redisHeadless, redisSentinelService := pira.RedisConfigMap(), pira.RedisService(), pira.RedisHeadlessService(), pira.RedisSentinelService()
+	switch {
+	case !pira.Spec.Redis.Enabled:
+	case pira.Spec.Redis.Mode == v1.RedisModeSentinel:
+		observed.redisStatefulSet, observed.redisSentinel = pira.RedisNodeStatefulSet(), pira.RedisSentinelStatefulSet()
+		objs = append(objs, redisConfig, redisHeadless, redisService, observed.redisStatefulSet, redisSentinelService, observed.redisSentinel)
+	case pira.Spec.Redis.Mode == v1.RedisModeReplicated:
+		observed.redisStatefulSet = pira.RedisNodeStatefulSet()
+		objs = append(objs, redisConfig, redisHeadless, redisService, observed.redisStatefulSet)
+	case pira.Spec.Redis.Persistence != nil:
+		observed.redisStatefulSet = pira.RedisStatefulSet()
+		objs = append(objs, redisConfig, redisService, observed.redisStatefulSet)
+	default:
+		observed.redis = pira.RedisDeployment()
+		objs = append(objs, redisConfig, redisService, observed.redis)
+	}
+	configChecksum := checksum([]byte(redisConfig.Data["redis.conf"]))
+	if observed.redis != nil {
+		setPodTemplateAnnotation(observed.redis, AnnotationRedisConfigChecksum, configChecksum)
+	}
+	if observed.redisStatefulSet != nil {
+		setPodTemplateAnnotation(observed.redisStatefulSet, AnnotationRedisConfigChecksum, configChecksum)
+	}
 	if pira.Spec.Redis.Enabled {
-		objs = append(objs, pira.RedisService(), pira.RedisDeployment())
-	} else {
-		for _, obj := range []client.Object{pira.RedisDeployment(), pira.RedisService()} {
-			if err := r.Client.Delete(ctx, obj, &client.DeleteOptions{}); client.IgnoreNotFound(err) != nil {
-				return reconcile.Result{}, fmt.Errorf("deleting: %v", err)
+		pending, err := r.redisPending(ctx, pira, observed)
+		if err != nil {
+			return observed, nil, err
+		}
+		observed.redisPending = pending
+	}
+	if observed.redisPending {
+		// PodInfo is only given the cache server once Redis is ready, rather than restarting
+		// into one that can't serve it yet.
+		withoutRedis := pira.DeepCopy()
+		withoutRedis.Spec.Redis.Enabled = false
+		observed.podInfo = withoutRedis.PodInfoDeployment()
+		observed.requeueWithin(redisHandoverInterval)
+	}
+	objs = append(objs, observed.podInfo)
+	if pira.Spec.Redis.Enabled {
+		password, secret, err := r.redisPassword(ctx, pira)
+		if err != nil {
+			return observed, nil, err
+		}
+		podInfoSecret, authChecksum, err := r.podInfoRedisPasswordSecret(ctx, pira, password)
+		if err != nil {
+			return observed, nil, err
+		}
+		// Applied first, so pods reading the password never start before it exists.
+		objs = append([]client.Object{podInfoSecret}, objs...)
+		if secret != nil {
+			objs = append([]client.Object{secret}, objs...)
+		}
+		for _, obj := range objs {
+			if obj != client.Object(observed.podInfo) || !observed.redisPending {
+				setPodTemplateAnnotation(obj, AnnotationRedisAuthChecksum, authChecksum)
 			}
 		}
 	}
+	if pira.Spec.Redis.Enabled && pira.Spec.Redis.TLS.Enabled {
+		data, secrets, renewal, err := r.redisTLS(ctx, pira)
+		if err != nil {
+			return observed, nil, err
+		}
+		if len(secrets) > 0 {
+			objs = append(secrets, objs...)
+			observed.requeueWithin(time.Until(renewal))
+		}
+		// PodInfo only restarts when the CA changes, Redis also when its certificate does.
+		if !observed.redisPending {
+			setPodTemplateAnnotation(observed.podInfo, AnnotationRedisTLSChecksum, checksum(data[caCertKey]))
+		}
+		redisChecksum := checksum(append(append([]byte{}, data[corev1.TLSCertKey]...), data[caCertKey]...))
+		if observed.redis != nil {
+			setPodTemplateAnnotation(observed.redis, AnnotationRedisTLSChecksum, redisChecksum)
+		}
+		for _, sts := range lo.Compact([]*appsv1.StatefulSet{observed.redisStatefulSet, observed.redisSentinel}) {
+			setPodTemplateAnnotation(sts, AnnotationRedisTLSChecksum, redisChecksum)
+		}
+	}
+	if external := pira.Spec.Redis.External; external != nil {
+		if ref := external.PasswordSecret; ref != nil {
+			password, err := r.secretKey(ctx, pira.Namespace, *ref)
+			if err != nil {
+				return observed, nil, fmt.Errorf("getting Redis password: %v", err)
+			}
+			podInfoSecret, authChecksum, err := r.podInfoRedisPasswordSecret(ctx, pira, password)
+			if err != nil {
+				return observed, nil, err
+			}
+			objs = append([]client.Object{podInfoSecret}, objs...)
+			setPodTemplateAnnotation(observed.podInfo, AnnotationRedisAuthChecksum, authChecksum)
+		}
+		if external.ReachabilityCheck {
+			observed.redisReachable = lo.ToPtr(redisReachableCondition(ctx, external.Address))
+			observed.requeueWithin(reachabilityCheckInterval)
+		}
+	}
+	if pira.Spec.Expose.Ingress != nil {
+		observed.ingress = pira.PodInfoIngress()
+		objs = append(objs, observed.ingress)
+	}
+	if pira.Spec.Expose.HTTPRoute != nil {
+		observed.httpRoute = pira.PodInfoHTTPRoute()
+		objs = append(objs, observed.httpRoute)
+	}
+	if pira.Spec.Autoscaling.Enabled {
+		objs = append(objs, pira.PodInfoHorizontalPodAutoscaler())
+	}
+	// A budget over a single pod would only block node drains, so it's left out until a
+	// component runs more than one.
+	podInfoReplicated := lo.Ternary(pira.Spec.Autoscaling.Enabled, pira.Spec.Autoscaling.MaxReplicas, lo.FromPtrOr(pira.Spec.ReplicaCount, 1)) > 1
+	if pira.Spec.DisruptionBudget.Enabled() && podInfoReplicated {
+		objs = append(objs, pira.PodInfoPodDisruptionBudget())
+	}
+	if pira.Spec.DisruptionBudget.Enabled() && pira.Spec.Redis.Enabled && pira.Spec.Redis.Mode.Replicated() {
+		objs = append(objs, pira.RedisPodDisruptionBudget())
+	}
+	// Last, as the canary copies the pod template of PodInfo, and a rollback replaces it.
+	if !pira.Paused() {
+		canaryObjs, err := r.progressiveRollout(ctx, pira, observed)
+		if err != nil {
+			return observed, nil, err
+		}
+		objs = append(objs, canaryObjs...)
+		if err := r.autoRollback(ctx, pira, observed); err != nil {
+			return observed, nil, err
+		}
+	}
+	return observed, objs, nil
+}
+
+// observeLive reads the live objects of observed in place of the desired ones, leaving those
+// that don't exist as desired. The Redis primary last found is kept, as Sentinel isn't asked.
+func (r *PodInfoRedisApplicationReconciler) observeLive(ctx context.Context, pira *v1.PodInfoRedisApplication, observed *observedState) error {
+	observed.redisPrimary = pira.Status.RedisPrimary
+	if pira.Spec.Rollout.Progressive != nil {
+		canary, err := r.getDeployment(ctx, pira.PodInfoCanaryDeployment())
+		if err != nil {
+			return err
+		}
+		observed.podInfoCanary = canary
+	}
+	objs := []client.Object{observed.podInfo, observed.podInfoService}
+	if observed.ingress != nil {
+		objs = append(objs, observed.ingress)
+	}
+	if observed.httpRoute != nil {
+		objs = append(objs, observed.httpRoute)
+	}
+	if observed.redis != nil {
+		objs = append(objs, observed.redis)
+	}
+	for _, sts := range lo.Compact([]*appsv1.StatefulSet{observed.redisStatefulSet, observed.redisSentinel}) {
+		objs = append(objs, sts)
+	}
 	for _, obj := range objs {
-		if err := controllerutil.SetControllerReference(pira, obj, r.Scheme); err != nil {
-			return reconcile.Result{}, fmt.Errorf("setting owner reference: %v", err)
+		err := r.Client.Get(ctx, client.ObjectKeyFromObject(obj), obj)
+		if client.IgnoreNotFound(err) != nil && !meta.IsNoMatchError(err) {
+			return fmt.Errorf("getting %v %v: %v", r.kindOf(obj), obj.GetName(), err)
 		}
-		if err := kubeclient.Apply(ctx, r.Client, obj); err != nil {
-			return reconcile.Result{}, fmt.Errorf("applying: %v", err)
+	}
+	return nil
+}
+
+// recordResumed records an event on pira listing the objects that were changed while it was
+// paused and have now been applied again.
+func (r *PodInfoRedisApplicationReconciler) recordResumed(pira *v1.PodInfoRedisApplication, observed *observedState) {
+	drifted, updated := observed.applied[kubeclient.ResultDriftCorrected], observed.applied[kubeclient.ResultUpdated]
+	if len(drifted) == 0 && len(updated) == 0 {
+		r.Recorder.Event(pira, corev1.EventTypeNormal, "Resumed", "Resumed reconciling, with no changes to overwrite")
+		return
+	}
+	var overwritten []string
+	if len(drifted) > 0 {
+		overwritten = append(overwritten, fmt.Sprintf("changes made outside the operator to %v", strings.Join(drifted, ", ")))
+	}
+	if len(updated) > 0 {
+		overwritten = append(overwritten, fmt.Sprintf("%v, which the spec has since changed", strings.Join(updated, ", ")))
+	}
+	r.Recorder.Eventf(pira, corev1.EventTypeNormal, "Resumed", "Resumed reconciling, overwriting %v", strings.Join(overwritten, "; and "))
+}
+
+// redisInventory returns the entries of inventory that belong to the managed Redis.
+func (r *PodInfoRedisApplicationReconciler) redisInventory(pira *v1.PodInfoRedisApplication, inventory []kubeclient.InventoryEntry) ([]kubeclient.InventoryEntry, error) {
+	var redis []kubeclient.InventoryEntry
+	for _, obj := range redisCandidates(pira) {
+		entry, err := kubeclient.InventoryEntryFor(r.Client, obj)
+		if err != nil {
+			return nil, err
 		}
+		redis = append(redis, entry)
 	}
+	return lo.Intersect(redis, inventory), nil
+}
 
-	if err := r.Client.Get(ctx, req.NamespacedName, pira); err != nil {
-		return reconcile.Result{}, client.IgnoreNotFound(err)
+// inventory returns the objects to prune those left out of the resource set from. Secrets the
+// spec references are left out, as the user may have taken over one the operator generated.
+// Applications reconciled before the inventory was recorded get every object the operator
+// may have created.
+func (r *PodInfoRedisApplicationReconciler) inventory(pira *v1.PodInfoRedisApplication) ([]kubeclient.InventoryEntry, error) {
+	var inventory []kubeclient.InventoryEntry
+	if pira.Status.Inventory != nil {
+		inventory = lo.Map(pira.Status.Inventory, func(entry v1.InventoryEntry, _ int) kubeclient.InventoryEntry {
+			return kubeclient.InventoryEntry(entry)
+		})
+	} else {
+		for _, obj := range ownedCandidates(pira) {
+			entry, err := kubeclient.InventoryEntryFor(r.Client, obj)
+			if err != nil {
+				return nil, err
+			}
+			inventory = append(inventory, entry)
+		}
+	}
+	referenced := lo.Compact([]string{pira.Spec.Redis.TLS.ExistingSecret})
+	if ref := pira.Spec.Redis.Auth.ExistingSecret; ref != nil {
+		referenced = append(referenced, ref.Name)
+	}
+	return lo.Reject(inventory, func(entry kubeclient.InventoryEntry, _ int) bool {
+		return entry.Group == "" && entry.Kind == "Secret" && lo.Contains(referenced, entry.Name)
+	}), nil
+}
+
+// observeApply records an event on pira, and updates its metrics, for each object applied
+// or pruned.
+func (r *PodInfoRedisApplicationReconciler) observeApply(pira *v1.PodInfoRedisApplication) kubeclient.ObserveFunc {
+	return func(obj client.Object, result kubeclient.Result, err error) {
+		kind := r.kindOf(obj)
+		switch {
+		case err != nil && result == kubeclient.ResultPruned:
+			r.Recorder.Eventf(pira, corev1.EventTypeWarning, "DeleteFailed", "Deleting %v %v: %v", kind, obj.GetName(), err)
+			return
+		case err != nil:
+			applyOperationsTotal.WithLabelValues(pira.Namespace, pira.Name, kind, "error").Inc()
+			r.Recorder.Eventf(pira, corev1.EventTypeWarning, "ApplyFailed", "Applying %v %v: %v", kind, obj.GetName(), err)
+			return
+		}
+		applyOperationsTotal.WithLabelValues(pira.Namespace, pira.Name, kind, string(result)).Inc()
+		switch result {
+		case kubeclient.ResultCreated:
+			r.Recorder.Eventf(pira, corev1.EventTypeNormal, "Created", "Created %v %v", kind, obj.GetName())
+		case kubeclient.ResultUpdated:
+			r.Recorder.Eventf(pira, corev1.EventTypeNormal, "Updated", "Updated %v %v", kind, obj.GetName())
+			hashMismatchesTotal.WithLabelValues(pira.Namespace, pira.Name, kind).Inc()
+		case kubeclient.ResultDriftCorrected:
+			r.Recorder.Eventf(pira, corev1.EventTypeWarning, "DriftDetected", "Restored %v %v, which was modified outside the operator", kind, obj.GetName())
+			driftCorrectionsTotal.WithLabelValues(pira.Namespace, pira.Name, kind).Inc()
+		case kubeclient.ResultPruned:
+			r.Recorder.Eventf(pira, corev1.EventTypeNormal, "Deleted", "Deleted %v %v", kind, obj.GetName())
+		}
+	}
+}
+
+// delete deletes obj if it exists, recording an event on pira if it did or on failure.
+func (r *PodInfoRedisApplicationReconciler) delete(ctx context.Context, pira *v1.PodInfoRedisApplication, obj client.Object, opts ...client.DeleteOption) (err error) {
+	ctx, span := kubeclient.StartSpan(ctx, r.Client, "Delete", obj)
+	outcome := "deleted"
+	defer func() { kubeclient.EndSpan(span, outcome, err) }()
+
+	err = r.Client.Delete(ctx, obj, opts...)
+	// A missing kind means its CRD, such as the Gateway API's, isn't installed, so there is nothing to delete.
+	if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		outcome = "absent"
+		return nil
+	}
+	if err != nil {
+		outcome = "failed"
+		r.Recorder.Eventf(pira, corev1.EventTypeWarning, "DeleteFailed", "Deleting %v %v: %v", r.kindOf(obj), obj.GetName(), err)
+		return fmt.Errorf("deleting: %v", err)
 	}
-	return ctrl.Result{}, nil
+	r.Recorder.Eventf(pira, corev1.EventTypeNormal, "Deleted", "Deleted %v %v", r.kindOf(obj), obj.GetName())
+	return nil
+}
+
+// kindOf returns the kind of obj, which typed objects leave out of their TypeMeta.
+func (r *PodInfoRedisApplicationReconciler) kindOf(obj client.Object) string {
+	gvk, err := apiutil.GVKForObject(obj, r.Scheme)
+	if err != nil {
+		return fmt.Sprintf("%T", obj)
+	}
+	return gvk.Kind
+}
+
+// CacheByObject restricts what the manager caches of the kinds the controller watches beyond
+// the objects it owns, so that it doesn't hold every one of them in the cluster.
+func CacheByObject() map[client.Object]cache.ByObject {
+	return map[client.Object]cache.ByObject{
+		// Only the ReplicaSets of PodInfo, which carry the labels of its pod template.
+		&appsv1.ReplicaSet{}: {Label: labels.SelectorFromSet(labels.Set{apiv1.LabelApplication: "podinfo"})},
+	}
+}
+
+// UncachedObjects are the kinds the manager's client reads from the API server instead of its
+// cache. The controller watches user-supplied Secrets, which carry none of its labels, so its
+// cache would otherwise hold the data of every Secret in the cluster.
+func UncachedObjects() []client.Object {
+	return []client.Object{&corev1.Secret{}}
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *PodInfoRedisApplicationReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &apiv1.PodInfoRedisApplication{}, redisSecretsField, redisSecretNames); err != nil {
+		return fmt.Errorf("indexing Redis Secrets: %v", err)
+	}
+
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&apiv1.PodInfoRedisApplication{}).
 		Owns(&appsv1.Deployment{}).
+		Owns(&appsv1.StatefulSet{}).
+		// Tracks whether new revisions of PodInfo become available, for automatic rollback.
+		Watches(&appsv1.ReplicaSet{}, handler.EnqueueRequestsFromMapFunc(r.applicationForReplicaSet)).
 		Owns(&corev1.Service{}).
-		Complete(r)
+		Owns(&corev1.ConfigMap{}).
+		// Secrets are only watched by their metadata, see UncachedObjects.
+		Owns(&corev1.Secret{}, builder.OnlyMetadata).
+		// Rolls out Redis and PodInfo when a user-supplied Redis password or certificate changes.
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.applicationsForSecret), builder.OnlyMetadata).
+		Owns(&networkingv1.Ingress{}).
+		Owns(&autoscalingv2.HorizontalPodAutoscaler{}).
+		Owns(&policyv1.PodDisruptionBudget{})
+	// HTTPRoutes are only watched if the Gateway API CRDs are installed, so the operator
+	// still starts in clusters without them.
+	if _, err := mgr.GetRESTMapper().RESTMapping(gatewayv1.SchemeGroupVersion.WithKind("HTTPRoute").GroupKind(), gatewayv1.SchemeGroupVersion.Version); err == nil {
+		b = b.Owns(&gatewayv1.HTTPRoute{})
+	} else if !meta.IsNoMatchError(err) {
+		return fmt.Errorf("looking up HTTPRoute: %v", err)
+	}
+	return b.Complete(r)
 }
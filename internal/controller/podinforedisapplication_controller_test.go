@@ -17,27 +17,51 @@ limitations under the License.
 package controller
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/samber/lo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	v1 "neeraj.angi/app-operator/api/v1"
+	"neeraj.angi/app-operator/util/kubeclient"
 )
 
 var _ = Describe("PodInfoRedisApplication Controller", func() {
 	var reconciler *PodInfoRedisApplicationReconciler
+	var recorder *record.FakeRecorder
 
 	var pira *v1.PodInfoRedisApplication
 	var podInfoNn types.NamespacedName
@@ -48,6 +72,85 @@ var _ = Describe("PodInfoRedisApplication Controller", func() {
 	var redisService corev1.Service
 	ctx := context.Background()
 
+	// reconcileApp reconciles pira once, as the manager would on a change to it.
+	reconcileApp := func() (reconcile.Result, error) {
+		return reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(pira)})
+	}
+	// mustReconcile reconciles pira once, expecting it to succeed.
+	mustReconcile := func() reconcile.Result {
+		GinkgoHelper()
+		result, err := reconcileApp()
+		Expect(err).NotTo(HaveOccurred())
+		return result
+	}
+	// createApp creates pira and reconciles it once.
+	createApp := func() reconcile.Result {
+		GinkgoHelper()
+		Expect(k8sClient.Create(ctx, pira)).To(Succeed())
+		return mustReconcile()
+	}
+	// markRedisReady has the Redis Deployment report its rollout complete, as the Deployment
+	// controller would, and reconciles pira, which gives PodInfo the cache server.
+	markRedisReady := func() {
+		GinkgoHelper()
+		markRolledOut(&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: redisNn.Namespace, Name: redisNn.Name}})
+		mustReconcile()
+	}
+	// expectApplication checks the PodInfo and Redis objects against the spec of pira.
+	expectApplication := func() {
+		GinkgoHelper()
+		Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(Succeed())
+		Expect(k8sClient.Get(ctx, podInfoNn, &podInfoService)).To(Succeed())
+
+		// Validate PodInfo Deployment
+		Expect(podInfoDeployment.OwnerReferences[0].UID).To(Equal(pira.UID))
+		Expect(*podInfoDeployment.Spec.Replicas).To(Equal(*pira.Spec.ReplicaCount))
+		env := lo.SliceToMap(podInfoDeployment.Spec.Template.Spec.Containers[0].Env, func(e corev1.EnvVar) (string, corev1.EnvVar) {
+			return e.Name, e
+		})
+		Expect(env["PODINFO_UI_COLOR"].Value).To(Equal(pira.Spec.UI.Color))
+		Expect(env["PODINFO_UI_MESSAGE"].Value).To(Equal(pira.Spec.UI.Message))
+		if pira.Spec.Redis.Enabled {
+			Expect(env["REDIS_PASSWORD"].ValueFrom.SecretKeyRef).To(Equal(lo.ToPtr(pira.PodInfoRedisPasswordSecretKeySelector())))
+			scheme := lo.Ternary(pira.Spec.Redis.TLS.Enabled, "rediss", "tcp")
+			Expect(env["PODINFO_CACHE_SERVER"].Value).To(Equal(fmt.Sprintf("%v://:$(REDIS_PASSWORD)@%v-redis:6379", scheme, pira.Name)))
+		} else if pira.Spec.Redis.External == nil {
+			Expect(env).NotTo(HaveKey("PODINFO_CACHE_SERVER"))
+			Expect(env).NotTo(HaveKey("REDIS_PASSWORD"))
+		}
+
+		Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Ports[0].ContainerPort).To(Equal(int32(9898)))
+		Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Ports[0].Protocol).To(Equal(corev1.ProtocolTCP))
+
+		Expect(*podInfoDeployment.Spec.Template.Spec.Containers[0].Resources.Limits.Memory()).To(Equal(pira.Spec.Resources.MemoryLimit))
+		Expect(*podInfoDeployment.Spec.Template.Spec.Containers[0].Resources.Requests.Cpu()).To(Equal(pira.Spec.Resources.CpuRequest))
+
+		// Validate PodInfo Service
+		Expect(podInfoService.OwnerReferences[0].UID).To(Equal(pira.UID))
+		Expect(podInfoService.Spec.Selector).To(Equal(podInfoDeployment.Spec.Selector.MatchLabels))
+		Expect(podInfoService.Spec.Ports[0].Port).To(Equal(int32(9898)))
+
+		if !pira.Spec.Redis.Enabled {
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, redisNn, &appsv1.Deployment{}))).To(BeTrue())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, redisNn, &corev1.Service{}))).To(BeTrue())
+			return
+		}
+		Expect(k8sClient.Get(ctx, redisNn, &redisDeployment)).To(Succeed())
+		Expect(k8sClient.Get(ctx, redisNn, &redisService)).To(Succeed())
+
+		// Validate Redis Deployment
+		Expect(redisDeployment.OwnerReferences[0].UID).To(Equal(pira.UID))
+		Expect(redisDeployment.Spec.Template.Spec.Containers[0].Ports[0].Name).To(Equal("redis"))
+		Expect(redisDeployment.Spec.Template.Spec.Containers[0].Ports[0].ContainerPort).To(Equal(int32(6379)))
+		Expect(redisDeployment.Spec.Template.Spec.Containers[0].Ports[0].Protocol).To(Equal(corev1.ProtocolTCP))
+
+		// Validate Redis Service
+		Expect(redisService.OwnerReferences[0].UID).To(Equal(pira.UID))
+		Expect(redisService.Spec.Selector).To(Equal(redisDeployment.Spec.Selector.MatchLabels))
+		Expect(redisService.Spec.Ports[0].Port).To(Equal(int32(6379)))
+		Expect(redisService.Spec.Ports[0].TargetPort.StrVal).To(Equal("redis"))
+	}
+
 	Context("When reconciling a resource", func() {
 		BeforeEach(func() {
 			pira = &v1.PodInfoRedisApplication{
@@ -76,102 +179,1237 @@ var _ = Describe("PodInfoRedisApplication Controller", func() {
 			}
 			podInfoNn = types.NamespacedName{Namespace: pira.Namespace, Name: fmt.Sprintf("%s-%s", pira.Name, "podinfo")}
 			redisNn = types.NamespacedName{Namespace: pira.Namespace, Name: fmt.Sprintf("%s-%s", pira.Name, "redis")}
+			recorder = record.NewFakeRecorder(1000)
 			reconciler = &PodInfoRedisApplicationReconciler{
-				Client: k8sClient,
-				Scheme: k8sClient.Scheme(),
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: recorder,
 			}
 		})
 		It("should only create podInfo resources if redis is disabled and create redis resources when enabled", func() {
-			Expect(k8sClient.Create(ctx, pira)).To(BeNil())
-			_, err := reconciler.Reconcile(ctx, reconcile.Request{
-				NamespacedName: types.NamespacedName{Namespace: pira.ObjectMeta.Namespace, Name: pira.ObjectMeta.Name},
-			})
-			Expect(err).NotTo(HaveOccurred())
+			createApp()
+			expectApplication()
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(BeNil())
+			cache := meta.FindStatusCondition(pira.Status.Conditions, v1.ConditionCacheEnabled)
+			Expect(cache).NotTo(BeNil())
+			Expect(cache.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cache.Reason).To(Equal("RedisDisabled"))
+			pira.Spec.Redis.Enabled = true
+			Expect(k8sClient.Update(ctx, pira)).To(BeNil())
+			result := mustReconcile()
+			Expect(result.RequeueAfter).To(Equal(redisHandoverInterval))
+
+			By("leaving PodInfo without a cache server until Redis is ready")
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(Succeed())
+			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Env).NotTo(ContainElement(HaveField("Name", "PODINFO_CACHE_SERVER")))
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(BeNil())
+			cache = meta.FindStatusCondition(pira.Status.Conditions, v1.ConditionCacheEnabled)
+			Expect(cache.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cache.Reason).To(Equal("WaitingForRedis"))
+
+			markRedisReady()
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(BeNil())
+			cache = meta.FindStatusCondition(pira.Status.Conditions, v1.ConditionCacheEnabled)
+			Expect(cache.Status).To(Equal(metav1.ConditionTrue))
+			Expect(cache.Reason).To(Equal("ManagedRedis"))
+			expectApplication()
+		})
+		It("should create redis resources if redis is enabled and then delete when disabled", func() {
+			pira.Spec.Redis.Enabled = true
+			createApp()
+			markRedisReady()
+			expectApplication()
+			Expect(drainEvents(recorder)).To(ContainElements(
+				"Normal Created Created Deployment "+podInfoNn.Name,
+				"Normal Created Created Deployment "+redisNn.Name,
+				"Normal Created Created Service "+redisNn.Name,
+			))
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(BeNil())
+			pira.Spec.Redis.Enabled = false
+			Expect(k8sClient.Update(ctx, pira)).To(BeNil())
+			result := mustReconcile()
+			Expect(result.RequeueAfter).To(Equal(redisHandoverInterval))
+
+			By("keeping Redis until PodInfo has rolled out without it")
+			events := drainEvents(recorder)
+			Expect(events).To(ContainElement("Normal Updated Updated Deployment " + podInfoNn.Name))
+			Expect(events).NotTo(ContainElement(HavePrefix("Normal Deleted")))
+			Expect(k8sClient.Get(ctx, redisNn, &redisDeployment)).To(Succeed())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			Expect(pira.Status.Inventory).To(ContainElement(HaveField("Name", redisNn.Name)))
+
+			markRolledOut(&podInfoDeployment)
+			mustReconcile()
+			Expect(drainEvents(recorder)).To(ContainElements(
+				"Normal Deleted Deleted Deployment "+redisNn.Name,
+				"Normal Deleted Deleted Service "+redisNn.Name,
+			))
+			expectApplication()
+		})
+		It("should record an event when an object can't be applied", func() {
+			// The API server rejects a liveness probe that must succeed more than once.
+			pira.Spec.Probes.Liveness = &v1.Probe{SuccessThreshold: lo.ToPtr(int32(2))}
+			Expect(k8sClient.Create(ctx, pira)).To(Succeed())
+			_, err := reconcileApp()
+			Expect(err).To(HaveOccurred())
+			Expect(drainEvents(recorder)).To(ContainElement(HavePrefix("Warning ApplyFailed Applying Deployment " + podInfoNn.Name + ":")))
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			pira.Spec.Probes.Liveness = nil
+			Expect(k8sClient.Update(ctx, pira)).To(Succeed())
+			mustReconcile()
+			Expect(drainEvents(recorder)).To(ContainElement("Normal Created Created Deployment " + podInfoNn.Name))
+		})
+
+		It("should export metrics about the application until it is deleted", func() {
+			pira.Spec.Redis.Enabled = true
+			createApp()
+			Expect(testutil.ToFloat64(applicationReady.WithLabelValues(pira.Namespace, pira.Name, "False"))).To(Equal(1.0))
+			Expect(testutil.ToFloat64(applicationReady.WithLabelValues(pira.Namespace, pira.Name, "True"))).To(Equal(0.0))
+			Expect(testutil.ToFloat64(applicationRedisEnabled.WithLabelValues(pira.Namespace, pira.Name))).To(Equal(1.0))
+			Expect(testutil.ToFloat64(applyOperationsTotal.WithLabelValues(pira.Namespace, pira.Name, "Deployment", "created"))).To(Equal(2.0))
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			pira.Spec.UI.Message = "updated"
+			Expect(k8sClient.Update(ctx, pira)).To(Succeed())
+			mustReconcile()
+			Expect(testutil.ToFloat64(applyOperationsTotal.WithLabelValues(pira.Namespace, pira.Name, "Deployment", "updated"))).To(Equal(1.0))
+			Expect(testutil.ToFloat64(applyOperationsTotal.WithLabelValues(pira.Namespace, pira.Name, "Deployment", "unchanged"))).To(Equal(1.0))
+			Expect(testutil.ToFloat64(hashMismatchesTotal.WithLabelValues(pira.Namespace, pira.Name, "Deployment"))).To(Equal(1.0))
+
+			Expect(k8sClient.Delete(ctx, pira)).To(Succeed())
+			mustReconcile()
+			// Other tests' applications export series too, so only this one's are looked for.
+			labels := prometheus.Labels{"namespace": pira.Namespace, "name": pira.Name}
+			Expect(applicationReady.DeletePartialMatch(labels)).To(BeZero())
+			Expect(applicationRedisEnabled.DeletePartialMatch(labels)).To(BeZero())
+			Expect(applyOperationsTotal.DeletePartialMatch(labels)).To(BeZero())
+			Expect(driftCorrectionsTotal.DeletePartialMatch(labels)).To(BeZero())
+			Expect(hashMismatchesTotal.DeletePartialMatch(labels)).To(BeZero())
+		})
+
+		It("should trace each reconcile with a span for every object it applies", func() {
+			spans := tracetest.NewSpanRecorder()
+			otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+			defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+			pira.Spec.Redis.Enabled = true
+			createApp()
+
+			ended := spans.Ended()
+			reconcileSpan, ok := lo.Find(ended, func(span sdktrace.ReadOnlySpan) bool { return span.Name() == "Reconcile" })
+			Expect(ok).To(BeTrue())
+			applies := lo.Filter(ended, func(span sdktrace.ReadOnlySpan, _ int) bool { return span.Name() == "Apply" })
+			Expect(applies).NotTo(BeEmpty())
+			attributes := map[string]map[attribute.Key]string{}
+			for _, span := range applies {
+				Expect(span.Parent().SpanID()).To(Equal(reconcileSpan.SpanContext().SpanID()))
+				values := map[attribute.Key]string{}
+				for _, kv := range span.Attributes() {
+					values[kv.Key] = kv.Value.Emit()
+				}
+				attributes[values[kubeclient.AttributeKind]+"/"+values[kubeclient.AttributeName]] = values
+			}
+			deployment := attributes["Deployment/"+podInfoNn.Name]
+			Expect(deployment).To(HaveKeyWithValue(kubeclient.AttributeOutcome, string(kubeclient.ResultCreated)))
+			Expect(attributes).To(HaveKey("Service/" + redisNn.Name))
 
 			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(BeNil())
-			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoService)).To(BeNil())
-			Expect(errors.IsNotFound(k8sClient.Get(ctx, redisNn, &appsv1.Deployment{}))).To(BeTrue())
-			Expect(errors.IsNotFound(k8sClient.Get(ctx, redisNn, &corev1.Service{}))).To(BeTrue())
+			Expect(deployment).To(HaveKeyWithValue(kubeclient.AttributeHash, podInfoDeployment.Annotations[kubeclient.AnnotationHash]))
+		})
+
+		It("should prune objects it applied once they leave the resource set", func() {
+			pira.Spec.Redis.Enabled = true
+			createApp()
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			Expect(pira.Status.Inventory).To(ContainElements(
+				v1.InventoryEntry{Group: "apps", Version: "v1", Kind: "Deployment", Name: redisNn.Name},
+				v1.InventoryEntry{Version: "v1", Kind: "Service", Name: podInfoNn.Name},
+				v1.InventoryEntry{Version: "v1", Kind: "ConfigMap", Name: pira.RedisConfigMap().Name},
+			))
+
+			By("recording an object it controls and one it doesn't in the inventory")
+			owned := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: pira.Namespace, Name: pira.Name + "-owned"}}
+			Expect(controllerutil.SetControllerReference(pira, owned, k8sClient.Scheme())).To(Succeed())
+			Expect(k8sClient.Create(ctx, owned)).To(Succeed())
+			foreign := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: pira.Namespace, Name: pira.Name + "-foreign"}}
+			Expect(k8sClient.Create(ctx, foreign)).To(Succeed())
+			pira.Status.Inventory = append(pira.Status.Inventory,
+				v1.InventoryEntry{Version: "v1", Kind: "ConfigMap", Name: owned.Name},
+				v1.InventoryEntry{Version: "v1", Kind: "ConfigMap", Name: foreign.Name},
+			)
+			Expect(k8sClient.Status().Update(ctx, pira)).To(Succeed())
 
+			mustReconcile()
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(owned), owned))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(foreign), foreign)).To(Succeed())
+			Expect(drainEvents(recorder)).To(ContainElement("Normal Deleted Deleted ConfigMap " + owned.Name))
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			Expect(pira.Status.Inventory).NotTo(ContainElement(HaveField("Name", owned.Name)))
+			Expect(pira.Status.Inventory).NotTo(ContainElement(HaveField("Name", foreign.Name)))
+			Expect(k8sClient.Delete(ctx, foreign)).To(Succeed())
+		})
+
+		It("should report component status and conditions", func() {
 			pira.Spec.Redis.Enabled = true
+			createApp()
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(BeNil())
+			Expect(pira.Status.ObservedGeneration).To(Equal(pira.Generation))
+			Expect(pira.Status.PodInfo.Replicas).To(Equal(*pira.Spec.ReplicaCount))
+			Expect(pira.Status.Redis).NotTo(BeNil())
+			// No Deployment controller runs in envtest, so availability is never reported.
+			Expect(meta.FindStatusCondition(pira.Status.Conditions, v1.ConditionPodInfoAvailable).Status).To(Equal(metav1.ConditionUnknown))
+			Expect(meta.FindStatusCondition(pira.Status.Conditions, v1.ConditionRedisAvailable).Status).To(Equal(metav1.ConditionUnknown))
+			Expect(meta.IsStatusConditionTrue(pira.Status.Conditions, v1.ConditionProgressing)).To(BeTrue())
+			Expect(meta.IsStatusConditionFalse(pira.Status.Conditions, v1.ConditionDegraded)).To(BeTrue())
+			Expect(meta.IsStatusConditionFalse(pira.Status.Conditions, v1.ConditionReady)).To(BeTrue())
+		})
+
+		It("should configure the PodInfo rollout and report one that passed its deadline", func() {
+			pira.Spec.Rollout = v1.Rollout{
+				MaxSurge:                lo.ToPtr(intstr.FromInt32(1)),
+				MaxUnavailable:          lo.ToPtr(intstr.FromInt32(0)),
+				MinReadySeconds:         10,
+				ProgressDeadlineSeconds: lo.ToPtr(int32(120)),
+				RevisionHistoryLimit:    lo.ToPtr(int32(3)),
+			}
+			createApp()
+
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(BeNil())
+			Expect(podInfoDeployment.Spec.Strategy.Type).To(Equal(appsv1.RollingUpdateDeploymentStrategyType))
+			Expect(podInfoDeployment.Spec.Strategy.RollingUpdate.MaxSurge).To(Equal(lo.ToPtr(intstr.FromInt32(1))))
+			Expect(podInfoDeployment.Spec.Strategy.RollingUpdate.MaxUnavailable).To(Equal(lo.ToPtr(intstr.FromInt32(0))))
+			Expect(podInfoDeployment.Spec.MinReadySeconds).To(Equal(int32(10)))
+			Expect(podInfoDeployment.Spec.ProgressDeadlineSeconds).To(Equal(lo.ToPtr(int32(120))))
+			Expect(podInfoDeployment.Spec.RevisionHistoryLimit).To(Equal(lo.ToPtr(int32(3))))
+
+			// No Deployment controller runs in envtest, so report the missed deadline by hand.
+			podInfoDeployment.Status.ObservedGeneration = podInfoDeployment.Generation
+			podInfoDeployment.Status.Conditions = []appsv1.DeploymentCondition{{
+				Type:    appsv1.DeploymentProgressing,
+				Status:  corev1.ConditionFalse,
+				Reason:  "ProgressDeadlineExceeded",
+				Message: `ReplicaSet "podinfo-abc" has timed out progressing.`,
+			}}
+			Expect(k8sClient.Status().Update(ctx, &podInfoDeployment)).To(Succeed())
+			mustReconcile()
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(BeNil())
+			progressing := meta.FindStatusCondition(pira.Status.Conditions, v1.ConditionProgressing)
+			Expect(progressing.Status).To(Equal(metav1.ConditionFalse))
+			Expect(progressing.Reason).To(Equal("ProgressDeadlineExceeded"))
+			Expect(progressing.Message).To(ContainSubstring(podInfoNn.Name))
+
+			pira.Spec.Rollout = v1.Rollout{Strategy: appsv1.RecreateDeploymentStrategyType}
+			Expect(k8sClient.Update(ctx, pira)).To(Succeed())
+			mustReconcile()
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(BeNil())
+			Expect(podInfoDeployment.Spec.Strategy.Type).To(Equal(appsv1.RecreateDeploymentStrategyType))
+			Expect(podInfoDeployment.Spec.Strategy.RollingUpdate).To(BeNil())
+		})
+
+		It("should roll a new image out through a canary and promote it", func() {
+			pira.Spec.Rollout.Progressive = &v1.ProgressiveRollout{Steps: []int32{50}, StepSeconds: lo.ToPtr(int32(0))}
+			createApp()
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			Expect(pira.Status.Rollout.Phase).To(Equal(v1.RolloutPhaseStable))
+			Expect(pira.Status.Rollout.StableImage).To(Equal("test-repo:test-tag"))
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(Succeed())
+			Expect(podInfoDeployment.Spec.Template.Labels).To(HaveKeyWithValue(v1.LabelTrack, v1.TrackStable))
+
+			pira.Spec.Image.Tag = "v2"
+			Expect(k8sClient.Update(ctx, pira)).To(Succeed())
+			drainEvents(recorder)
+			mustReconcile()
+			Expect(drainEvents(recorder)).To(ContainElement(ContainSubstring("RolloutStarted")))
+			canary := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira.PodInfoCanaryDeployment()), canary)).To(Succeed())
+			Expect(canary.Spec.Template.Spec.Containers[0].Image).To(Equal("test-repo:v2"))
+			Expect(*canary.Spec.Replicas).To(Equal(int32(1)))
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(Succeed())
+			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Image).To(Equal("test-repo:test-tag"))
+			Expect(*podInfoDeployment.Spec.Replicas).To(Equal(int32(1)))
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			Expect(pira.Status.Rollout.Phase).To(Equal(v1.RolloutPhaseProgressing))
+			Expect(pira.Status.Rollout.Weight).To(Equal(int32(50)))
+
+			markRolledOut(canary)
+			mustReconcile()
+			Expect(drainEvents(recorder)).To(ContainElement(ContainSubstring("Promoting")))
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(canary), canary)).To(Succeed())
+			Expect(*canary.Spec.Replicas).To(Equal(int32(2)))
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(Succeed())
+			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Image).To(Equal("test-repo:v2"))
+
+			markRolledOut(&podInfoDeployment)
+			mustReconcile()
+			Expect(drainEvents(recorder)).To(ContainElement(ContainSubstring("Promoted")))
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(canary), canary))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			Expect(pira.Status.Rollout.Phase).To(Equal(v1.RolloutPhaseStable))
+			Expect(pira.Status.Rollout.StableImage).To(Equal("test-repo:v2"))
+			Expect(pira.Status.Rollout.History).To(HaveLen(1))
+			Expect(pira.Status.Rollout.History[0].Result).To(Equal(v1.RolloutResultPromoted))
+		})
+
+		It("should recreate a PodInfo Deployment whose selector would overlap the canary's once rolling out progressively", func() {
+			Expect(k8sClient.Create(ctx, pira)).To(Succeed())
+			legacy := pira.PodInfoDeployment()
+			legacy.Spec.Selector = &metav1.LabelSelector{MatchLabels: legacy.Spec.Template.Labels}
+			Expect(controllerutil.SetControllerReference(pira, legacy, k8sClient.Scheme())).To(Succeed())
+			Expect(k8sClient.Create(ctx, legacy)).To(Succeed())
+
+			By("keeping it while there is no canary")
+			mustReconcile()
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(Succeed())
+			Expect(podInfoDeployment.UID).To(Equal(legacy.UID))
+			Expect(podInfoDeployment.DeletionTimestamp).To(BeNil())
+			Expect(podInfoDeployment.Spec.Selector.MatchExpressions).To(BeEmpty())
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			pira.Spec.Rollout.Progressive = &v1.ProgressiveRollout{}
+			Expect(k8sClient.Update(ctx, pira)).To(Succeed())
+			result := mustReconcile()
+			Expect(result.RequeueAfter).To(Equal(recreateCheckInterval))
+			Expect(drainEvents(recorder)).To(ContainElement("Normal Deleted Deleted Deployment " + podInfoNn.Name))
+			// The garbage collector, which would orphan the ReplicaSets, doesn't run in envtest.
+			Expect(k8sClient.Get(ctx, podInfoNn, legacy)).To(Succeed())
+			Expect(legacy.Finalizers).To(ConsistOf(metav1.FinalizerOrphanDependents))
+			mustReconcile()
+			legacy.Finalizers = nil
+			Expect(k8sClient.Update(ctx, legacy)).To(Succeed())
+
+			mustReconcile()
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(Succeed())
+			Expect(podInfoDeployment.UID).NotTo(Equal(legacy.UID))
+			Expect(podInfoDeployment.Spec.Selector.MatchExpressions).To(ConsistOf(metav1.LabelSelectorRequirement{
+				Key:      v1.LabelTrack,
+				Operator: metav1.LabelSelectorOpNotIn,
+				Values:   []string{v1.TrackCanary},
+			}))
+		})
+
+		It("should roll a blue-green canary back once it fails its check past the deadline", func() {
+			checker := &fakeHealthChecker{err: fmt.Errorf("connection refused")}
+			reconciler.HealthChecker = checker
+			pira.Spec.Rollout.Progressive = &v1.ProgressiveRollout{Strategy: v1.ProgressiveStrategyBlueGreen, Check: v1.RolloutCheckHTTP}
+			createApp()
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			pira.Spec.Image.Tag = "broken"
+			Expect(k8sClient.Update(ctx, pira)).To(Succeed())
+			mustReconcile()
+			canary := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira.PodInfoCanaryDeployment()), canary)).To(Succeed())
+			Expect(*canary.Spec.Replicas).To(Equal(int32(2)))
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoService)).To(Succeed())
+			Expect(podInfoService.Spec.Selector).To(HaveKeyWithValue(v1.LabelTrack, v1.TrackStable))
+
+			markRolledOut(canary)
+			result := mustReconcile()
+			Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+			Expect(checker.urls).To(ContainElement("http://test-app-podinfo-canary.default.svc:9898/healthz"))
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			Expect(pira.Status.Rollout.Phase).To(Equal(v1.RolloutPhaseProgressing))
+
+			pira.Status.Rollout.StepStartTime = lo.ToPtr(metav1.NewTime(time.Now().Add(-10 * time.Minute)))
+			Expect(k8sClient.Status().Update(ctx, pira)).To(Succeed())
+			drainEvents(recorder)
+			for i := 0; i < 2; i++ {
+				mustReconcile()
+			}
+			Expect(drainEvents(recorder)).To(ContainElement(And(ContainSubstring("RolledBack"), ContainSubstring("connection refused"))))
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(canary), canary))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			Expect(pira.Status.Rollout.Phase).To(Equal(v1.RolloutPhaseRolledBack))
+			Expect(pira.Status.Rollout.CanaryImage).To(Equal("test-repo:broken"))
+			Expect(pira.Status.Rollout.History).To(ConsistOf(HaveField("Result", v1.RolloutResultRolledBack)))
+
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(BeNil())
+			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Image).To(Equal("test-repo:test-tag"))
+		})
+
+		It("should roll PodInfo back to its last available template once a revision stalls", func() {
+			pira.Spec.Rollout.AutoRollback = &v1.AutoRollback{}
+			createApp()
+
+			// Revision 1 becomes available, and its template is recorded as known-good.
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(Succeed())
+			setRevision(&podInfoDeployment, "1", *podInfoDeployment.Spec.Replicas)
+			markRolledOut(&podInfoDeployment)
+			mustReconcile()
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			Expect(pira.Status.AutoRollback.Revision).To(Equal("1"))
+			Expect(pira.Status.AutoRollback.KnownGoodRevision).To(Equal("1"))
+			Expect(pira.Status.AutoRollback.KnownGoodTemplateChecksum).NotTo(BeEmpty())
+			Expect(meta.IsStatusConditionFalse(pira.Status.Conditions, v1.ConditionRolledBack)).To(BeTrue())
+
+			// Revision 2 runs a tag that never becomes available.
+			pira.Spec.Image.Tag = "broken"
+			Expect(k8sClient.Update(ctx, pira)).To(Succeed())
+			mustReconcile()
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(Succeed())
+			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Image).To(Equal("test-repo:broken"))
+			setRevision(&podInfoDeployment, "2", 0)
+			result := mustReconcile()
+			Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(Succeed())
+			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Image).To(Equal("test-repo:broken"))
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			Expect(pira.Status.AutoRollback.Revision).To(Equal("2"))
+			pira.Status.AutoRollback.RevisionTime = lo.ToPtr(metav1.NewTime(time.Now().Add(-time.Hour)))
+			Expect(k8sClient.Status().Update(ctx, pira)).To(Succeed())
+			drainEvents(recorder)
+			for i := 0; i < 2; i++ {
+				mustReconcile()
+			}
+			Expect(drainEvents(recorder)).To(ContainElement(And(ContainSubstring("RolledBack"), ContainSubstring("revision 2"))))
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(Succeed())
+			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Image).To(Equal("test-repo:test-tag"))
+			Expect(podInfoDeployment.Spec.Template.Labels).NotTo(HaveKey(appsv1.DefaultDeploymentUniqueLabelKey))
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			Expect(pira.Spec.Image.Tag).To(Equal("broken"))
+			Expect(pira.Status.AutoRollback.FailedRevision).To(Equal("2"))
+			condition := meta.FindStatusCondition(pira.Status.Conditions, v1.ConditionRolledBack)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+			Expect(condition.Reason).To(Equal("RevisionUnavailable"))
+
+			// Changing the spec rolls the new template out again.
+			pira.Spec.Image.Tag = "fixed"
+			Expect(k8sClient.Update(ctx, pira)).To(Succeed())
+			mustReconcile()
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(Succeed())
+			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Image).To(Equal("test-repo:fixed"))
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			Expect(meta.IsStatusConditionFalse(pira.Status.Conditions, v1.ConditionRolledBack)).To(BeTrue())
+		})
+
+		It("should leave a stalled revision in place once the known-good ReplicaSet is gone", func() {
+			pira.Spec.Rollout.AutoRollback = &v1.AutoRollback{}
+			createApp()
+
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(Succeed())
+			setRevision(&podInfoDeployment, "1", *podInfoDeployment.Spec.Replicas)
+			markRolledOut(&podInfoDeployment)
+			mustReconcile()
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			pira.Spec.Image.Tag = "broken"
+			Expect(k8sClient.Update(ctx, pira)).To(Succeed())
+			mustReconcile()
+			setRevision(&podInfoDeployment, "2", 0)
+			mustReconcile()
+			Expect(k8sClient.Delete(ctx, &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: podInfoNn.Namespace, Name: podInfoNn.Name + "-1"}})).To(Succeed())
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			pira.Status.AutoRollback.RevisionTime = lo.ToPtr(metav1.NewTime(time.Now().Add(-time.Hour)))
+			Expect(k8sClient.Status().Update(ctx, pira)).To(Succeed())
+			drainEvents(recorder)
+			mustReconcile()
+			Expect(drainEvents(recorder)).To(ContainElement(And(ContainSubstring("RollbackUnavailable"), ContainSubstring("revision 1"))))
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(Succeed())
+			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Image).To(Equal("test-repo:broken"))
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			Expect(pira.Status.AutoRollback.KnownGoodRevision).To(BeEmpty())
+			Expect(meta.IsStatusConditionFalse(pira.Status.Conditions, v1.ConditionRolledBack)).To(BeTrue())
+		})
+
+		It("should apply resources server-side when configured", func() {
+			reconciler.ApplyOptions = kubeclient.Options{ServerSide: true}
+			createApp()
+
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(BeNil())
+			Expect(podInfoDeployment.ManagedFields).To(ContainElement(And(
+				HaveField("Manager", kubeclient.FieldManager),
+				HaveField("Operation", metav1.ManagedFieldsOperationApply),
+			)))
+		})
+
+		It("should take over objects it updated before switching to server-side apply", func() {
+			createApp()
+
+			reconciler.ApplyOptions = kubeclient.Options{ServerSide: true}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: pira.ObjectMeta.Namespace, Name: pira.ObjectMeta.Name}, pira)).To(BeNil())
+			pira.Spec.UI.Message = "applied"
 			Expect(k8sClient.Update(ctx, pira)).To(BeNil())
-			_, err = reconciler.Reconcile(ctx, reconcile.Request{
-				NamespacedName: types.NamespacedName{Namespace: pira.ObjectMeta.Namespace, Name: pira.ObjectMeta.Name},
-			})
-			Expect(err).NotTo(HaveOccurred())
+			mustReconcile()
+
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(BeNil())
+			Expect(podInfoDeployment.ManagedFields).To(ConsistOf(
+				HaveField("Operation", metav1.ManagedFieldsOperationApply),
+			))
+		})
+
+		It("should restore owned objects edited outside the operator", func() {
+			createApp()
+
+			drainEvents(recorder)
+			// Edit the Deployment the way `kubectl edit` would, leaving the hash annotation alone.
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(BeNil())
+			podInfoDeployment.Spec.Template.Spec.Containers[0].Env[1].Value = "edited by hand"
+			Expect(k8sClient.Update(ctx, &podInfoDeployment)).To(BeNil())
+
+			mustReconcile()
+			Expect(recorder.Events).To(Receive(ContainSubstring("DriftDetected")))
+		})
+
+		It("should leave objects alone while paused and restore them on resuming", func() {
+			createApp()
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			pira.Annotations = map[string]string{v1.AnnotationPaused: "true"}
+			Expect(k8sClient.Update(ctx, pira)).To(Succeed())
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(BeNil())
+			podInfoDeployment.Spec.Template.Spec.Containers[0].Env[1].Value = "edited by hand"
+			Expect(k8sClient.Update(ctx, &podInfoDeployment)).To(BeNil())
+			drainEvents(recorder)
+
+			mustReconcile()
+			Expect(drainEvents(recorder)).To(BeEmpty())
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(BeNil())
+			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Env[1].Value).To(Equal("edited by hand"))
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			paused := meta.FindStatusCondition(pira.Status.Conditions, v1.ConditionPaused)
+			Expect(paused).NotTo(BeNil())
+			Expect(paused.Status).To(Equal(metav1.ConditionTrue))
+			Expect(paused.Reason).To(Equal("AnnotationPaused"))
+			Expect(meta.FindStatusCondition(pira.Status.Conditions, v1.ConditionPodInfoAvailable)).NotTo(BeNil())
+
+			pira.Annotations = nil
+			Expect(k8sClient.Update(ctx, pira)).To(Succeed())
+			mustReconcile()
+			Expect(drainEvents(recorder)).To(ContainElement(And(
+				ContainSubstring("Resumed"),
+				ContainSubstring("Deployment "+podInfoNn.Name),
+			)))
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(BeNil())
+			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Env[1].Value).NotTo(Equal("edited by hand"))
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			Expect(meta.FindStatusCondition(pira.Status.Conditions, v1.ConditionPaused)).To(BeNil())
+		})
+
+		It("should probe PodInfo with defaults that can be overridden", func() {
+			pira.Spec.Probes.Readiness = &v1.Probe{Path: "/readyz/custom", PeriodSeconds: lo.ToPtr(int32(20))}
+			createApp()
+
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(BeNil())
+
+			container := podInfoDeployment.Spec.Template.Spec.Containers[0]
+			Expect(container.LivenessProbe.HTTPGet.Path).To(Equal("/healthz"))
+			Expect(container.StartupProbe.HTTPGet.Path).To(Equal("/healthz"))
+			Expect(container.ReadinessProbe.HTTPGet.Path).To(Equal("/readyz/custom"))
+			Expect(container.ReadinessProbe.HTTPGet.Port.StrVal).To(Equal("podinfo"))
+			Expect(container.ReadinessProbe.PeriodSeconds).To(Equal(int32(20)))
+			Expect(container.ReadinessProbe.FailureThreshold).To(Equal(int32(3)))
+		})
+
+		It("should manage PodDisruptionBudgets only while a budget is set", func() {
+			pira.Spec.Redis.Enabled = true
+			pira.Spec.DisruptionBudget.MinAvailable = lo.ToPtr(intstr.FromInt32(1))
+			createApp()
 
 			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(BeNil())
+			var podInfoPdb, redisPdb policyv1.PodDisruptionBudget
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoPdb)).To(BeNil())
+			Expect(podInfoPdb.OwnerReferences[0].UID).To(Equal(pira.UID))
+			Expect(podInfoPdb.Spec.MinAvailable.IntValue()).To(Equal(1))
+			Expect(podInfoPdb.Spec.Selector.MatchLabels).To(Equal(podInfoDeployment.Spec.Selector.MatchLabels))
+			By("leaving the single standalone Redis pod without one")
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, redisNn, &redisPdb))).To(BeTrue())
+
+			By("budgeting Redis once it runs replicas")
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			pira.Spec.Redis.Mode = v1.RedisModeReplicated
+			Expect(k8sClient.Update(ctx, pira)).To(Succeed())
+			mustReconcile()
+			var redisNodes appsv1.StatefulSet
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira.RedisNodeStatefulSet()), &redisNodes)).To(Succeed())
+			Expect(k8sClient.Get(ctx, redisNn, &redisPdb)).To(BeNil())
+			Expect(redisPdb.Spec.Selector.MatchLabels).To(Equal(redisNodes.Spec.Selector.MatchLabels))
+
+			By("dropping the PodInfo budget once it runs a single replica")
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			pira.Spec.ReplicaCount = lo.ToPtr(int32(1))
+			Expect(k8sClient.Update(ctx, pira)).To(Succeed())
+			mustReconcile()
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, podInfoNn, &podInfoPdb))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, redisNn, &redisPdb)).To(BeNil())
+
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: pira.ObjectMeta.Namespace, Name: pira.ObjectMeta.Name}, pira)).To(BeNil())
+			pira.Spec.DisruptionBudget = v1.DisruptionBudget{}
+			Expect(k8sClient.Update(ctx, pira)).To(BeNil())
+			mustReconcile()
+
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, redisNn, &redisPdb))).To(BeTrue())
+		})
+
+		It("should hand PodInfo replicas over to a HorizontalPodAutoscaler while autoscaling", func() {
+			pira.Spec.Autoscaling = v1.Autoscaling{
+				Enabled:                        true,
+				MinReplicas:                    lo.ToPtr(int32(2)),
+				MaxReplicas:                    5,
+				TargetCPUUtilizationPercentage: lo.ToPtr(int32(75)),
+			}
+			createApp()
+
+			var hpa autoscalingv2.HorizontalPodAutoscaler
+			Expect(k8sClient.Get(ctx, podInfoNn, &hpa)).To(BeNil())
+			Expect(hpa.OwnerReferences[0].UID).To(Equal(pira.UID))
+			Expect(hpa.Spec.ScaleTargetRef.Kind).To(Equal("Deployment"))
+			Expect(hpa.Spec.ScaleTargetRef.Name).To(Equal(podInfoNn.Name))
+			Expect(*hpa.Spec.MinReplicas).To(Equal(int32(2)))
+			Expect(hpa.Spec.MaxReplicas).To(Equal(int32(5)))
+			Expect(*hpa.Spec.Metrics[0].Resource.Target.AverageUtilization).To(Equal(int32(75)))
+
+			// Scale the Deployment the way the HorizontalPodAutoscaler would, then change the spec.
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(BeNil())
+			podInfoDeployment.Spec.Replicas = lo.ToPtr(int32(4))
+			Expect(k8sClient.Update(ctx, &podInfoDeployment)).To(BeNil())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: pira.ObjectMeta.Namespace, Name: pira.ObjectMeta.Name}, pira)).To(BeNil())
+			pira.Spec.UI.Message = "scaled"
+			Expect(k8sClient.Update(ctx, pira)).To(BeNil())
+			mustReconcile()
+
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(BeNil())
+			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Env[1].Value).To(Equal("scaled"))
+			Expect(*podInfoDeployment.Spec.Replicas).To(Equal(int32(4)))
+		})
+
+		It("should keep PodInfo replicas applied server-side until a HorizontalPodAutoscaler takes them over", func() {
+			reconciler.ApplyOptions = kubeclient.Options{ServerSide: true}
+			pira.Spec.ReplicaCount = lo.ToPtr(int32(3))
+			createApp()
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			pira.Spec.Autoscaling = v1.Autoscaling{Enabled: true, MaxReplicas: 5}
+			Expect(k8sClient.Update(ctx, pira)).To(Succeed())
+			mustReconcile()
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(Succeed())
+			Expect(*podInfoDeployment.Spec.Replicas).To(Equal(int32(3)))
+
+			// Scale the Deployment the way the HorizontalPodAutoscaler would, through its scale
+			// subresource, then change the spec.
+			scale := &autoscalingv1.Scale{Spec: autoscalingv1.ScaleSpec{Replicas: 4}}
+			Expect(k8sClient.SubResource("scale").Update(ctx, &podInfoDeployment, client.WithSubResourceBody(scale), client.FieldOwner("horizontal-pod-autoscaler"))).To(Succeed())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			pira.Spec.UI.Message = "scaled"
+			Expect(k8sClient.Update(ctx, pira)).To(Succeed())
+			mustReconcile()
+
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(Succeed())
+			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Env[1].Value).To(Equal("scaled"))
+			Expect(*podInfoDeployment.Spec.Replicas).To(Equal(int32(4)))
+			applied, ok := lo.Find(podInfoDeployment.ManagedFields, func(entry metav1.ManagedFieldsEntry) bool {
+				return entry.Manager == kubeclient.FieldManager && entry.Operation == metav1.ManagedFieldsOperationApply
+			})
+			Expect(ok).To(BeTrue())
+			Expect(string(applied.FieldsV1.Raw)).NotTo(ContainSubstring(`"f:replicas"`))
+		})
+
+		It("should expose PodInfo through an Ingress and report its URL", func() {
+			pira.Spec.Expose = v1.Expose{
+				ServiceType: corev1.ServiceTypeClusterIP,
+				Ingress: &v1.Ingress{
+					Route: v1.Route{
+						Host:        "podinfo.example.com",
+						Annotations: map[string]string{"nginx.ingress.kubernetes.io/ssl-redirect": "true"},
+					},
+					TLSSecretName: "podinfo-tls",
+				},
+			}
+			createApp()
+
 			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoService)).To(BeNil())
+			Expect(podInfoService.Spec.Type).To(Equal(corev1.ServiceTypeClusterIP))
+
+			var ingress networkingv1.Ingress
+			Expect(k8sClient.Get(ctx, podInfoNn, &ingress)).To(BeNil())
+			Expect(ingress.OwnerReferences[0].UID).To(Equal(pira.UID))
+			Expect(ingress.Annotations).To(HaveKeyWithValue("nginx.ingress.kubernetes.io/ssl-redirect", "true"))
+			Expect(ingress.Spec.TLS[0].SecretName).To(Equal("podinfo-tls"))
+			Expect(ingress.Spec.Rules[0].Host).To(Equal("podinfo.example.com"))
+			Expect(ingress.Spec.Rules[0].HTTP.Paths[0].Path).To(Equal("/"))
+			Expect(ingress.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Name).To(Equal(podInfoService.Name))
+
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: pira.ObjectMeta.Namespace, Name: pira.ObjectMeta.Name}, pira)).To(BeNil())
+			Expect(pira.Status.URL).To(Equal("https://podinfo.example.com/"))
+
+			pira.Spec.Expose.Ingress = nil
+			Expect(k8sClient.Update(ctx, pira)).To(BeNil())
+			mustReconcile()
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, podInfoNn, &ingress))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: pira.ObjectMeta.Namespace, Name: pira.ObjectMeta.Name}, pira)).To(BeNil())
+			Expect(pira.Status.URL).To(Equal(fmt.Sprintf("http://%v.%v.svc:9898", podInfoNn.Name, podInfoNn.Namespace)))
+		})
+
+		It("should run Redis as a StatefulSet while persistence is enabled", func() {
+			pira.Spec.Redis.Enabled = true
+			pira.Spec.Redis.Persistence = &v1.Persistence{
+				StorageClassName: lo.ToPtr("standard"),
+				Size:             resource.MustParse("2Gi"),
+				Mode:             v1.PersistenceModeAOF,
+				RetentionPolicy:  appsv1.DeletePersistentVolumeClaimRetentionPolicyType,
+			}
+			createApp()
+
+			var redisStatefulSet appsv1.StatefulSet
+			Expect(k8sClient.Get(ctx, redisNn, &redisStatefulSet)).To(BeNil())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, redisNn, &redisDeployment))).To(BeTrue())
+			Expect(redisStatefulSet.OwnerReferences[0].UID).To(Equal(pira.UID))
+			Expect(redisStatefulSet.Spec.ServiceName).To(Equal(redisNn.Name))
+			Expect(redisStatefulSet.Spec.Template.Spec.Containers[0].Command).To(ContainElements("--appendonly", "yes"))
+			Expect(redisStatefulSet.Spec.Template.Spec.Containers[0].VolumeMounts).To(ContainElement(HaveField("MountPath", "/data")))
+			claim := redisStatefulSet.Spec.VolumeClaimTemplates[0]
+			Expect(*claim.Spec.StorageClassName).To(Equal("standard"))
+			Expect(claim.Spec.Resources.Requests[corev1.ResourceStorage]).To(Equal(resource.MustParse("2Gi")))
+			Expect(redisStatefulSet.Spec.PersistentVolumeClaimRetentionPolicy.WhenDeleted).To(Equal(appsv1.DeletePersistentVolumeClaimRetentionPolicyType))
+
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: pira.ObjectMeta.Namespace, Name: pira.ObjectMeta.Name}, pira)).To(BeNil())
+			pira.Spec.Redis.Persistence = nil
+			Expect(k8sClient.Update(ctx, pira)).To(BeNil())
+			mustReconcile()
+
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, redisNn, &redisStatefulSet))).To(BeTrue())
+		})
+
+		It("should generate a Redis password once and roll out both components with it", func() {
+			pira.Spec.Redis.Enabled = true
+			createApp()
+			markRedisReady()
+
+			var secret corev1.Secret
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: pira.Namespace, Name: pira.Name + "-redis-auth"}, &secret)).To(BeNil())
+			Expect(secret.OwnerReferences[0].UID).To(Equal(pira.UID))
+			Expect(secret.Data["password"]).To(HaveLen(48))
+
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(BeNil())
 			Expect(k8sClient.Get(ctx, redisNn, &redisDeployment)).To(BeNil())
-			Expect(k8sClient.Get(ctx, redisNn, &redisService)).To(BeNil())
+			redisContainer := redisDeployment.Spec.Template.Spec.Containers[0]
+			Expect(redisContainer.Command).To(Equal([]string{"redis-server", "/etc/redis/redis.conf", "--requirepass", "$(REDISCLI_AUTH)"}))
+			Expect(redisContainer.Env[0].ValueFrom.SecretKeyRef.Name).To(Equal(secret.Name))
+			checksum := podInfoDeployment.Spec.Template.Annotations[AnnotationRedisAuthChecksum]
+			Expect(checksum).NotTo(BeEmpty())
+			Expect(redisDeployment.Spec.Template.Annotations[AnnotationRedisAuthChecksum]).To(Equal(checksum))
+
+			By("deleting the Secret to rotate the password")
+			Expect(k8sClient.Delete(ctx, &secret)).To(Succeed())
+			mustReconcile()
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(BeNil())
+			Expect(k8sClient.Get(ctx, redisNn, &redisDeployment)).To(BeNil())
+			Expect(podInfoDeployment.Spec.Template.Annotations[AnnotationRedisAuthChecksum]).NotTo(Equal(checksum))
+			Expect(redisDeployment.Spec.Template.Annotations[AnnotationRedisAuthChecksum]).To(Equal(podInfoDeployment.Spec.Template.Annotations[AnnotationRedisAuthChecksum]))
 		})
-		It("should create redis resources if redis is enabled and then delete when disabled", func() {
+
+		It("should read the Redis password from a user-supplied Secret", func() {
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: pira.Namespace, Name: "user-redis-password"},
+				StringData: map[string]string{"redis-password": "hunter2"},
+			}
+			Expect(k8sClient.Create(ctx, secret)).To(Succeed())
 			pira.Spec.Redis.Enabled = true
-			Expect(k8sClient.Create(ctx, pira)).To(BeNil())
-			_, err := reconciler.Reconcile(ctx, reconcile.Request{
-				NamespacedName: types.NamespacedName{Namespace: pira.ObjectMeta.Namespace, Name: pira.ObjectMeta.Name},
-			})
+			pira.Spec.Redis.Auth.ExistingSecret = &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: secret.Name},
+				Key:                  "redis-password",
+			}
+			createApp()
+
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, types.NamespacedName{Namespace: pira.Namespace, Name: pira.Name + "-redis-auth"}, &corev1.Secret{}))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, redisNn, &redisDeployment)).To(BeNil())
+			Expect(redisDeployment.Spec.Template.Spec.Containers[0].Env[0].ValueFrom.SecretKeyRef).To(Equal(pira.Spec.Redis.Auth.ExistingSecret))
+			Expect(redisSecretNames(pira)).To(Equal([]string{secret.Name}))
+
+			By("annotating the pod templates with a checksum that doesn't reveal the password")
+			authChecksum := redisDeployment.Spec.Template.Annotations[AnnotationRedisAuthChecksum]
+			Expect(authChecksum).NotTo(BeEmpty())
+			Expect(authChecksum).NotTo(Equal(checksum([]byte("hunter2"))))
+			mustReconcile()
+			Expect(k8sClient.Get(ctx, redisNn, &redisDeployment)).To(Succeed())
+			Expect(redisDeployment.Spec.Template.Annotations[AnnotationRedisAuthChecksum]).To(Equal(authChecksum))
+			Expect(k8sClient.Delete(ctx, secret)).To(Succeed())
+		})
+
+		It("should run the configured Redis image and roll it out when its config changes", func() {
+			pira.Spec.Redis.Enabled = true
+			pira.Spec.Redis.Image = v1.RedisImage{
+				Repository: "registry.example.com/redis",
+				Tag:        "7.2.4",
+				Digest:     "sha256:" + strings.Repeat("a", 64),
+				PullPolicy: corev1.PullIfNotPresent,
+			}
+			pira.Spec.Redis.Resources = corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+			}
+			pira.Spec.Redis.Config = map[string]string{"maxmemory-policy": "allkeys-lru", "maxmemory": "100mb"}
+			createApp()
+
+			var config corev1.ConfigMap
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: pira.Namespace, Name: pira.Name + "-redis-config"}, &config)).To(BeNil())
+			Expect(config.OwnerReferences[0].UID).To(Equal(pira.UID))
+			Expect(config.Data["redis.conf"]).To(Equal("maxmemory 100mb\nmaxmemory-policy allkeys-lru\n"))
+
+			Expect(k8sClient.Get(ctx, redisNn, &redisDeployment)).To(BeNil())
+			redisContainer := redisDeployment.Spec.Template.Spec.Containers[0]
+			Expect(redisContainer.Image).To(Equal("registry.example.com/redis:7.2.4@sha256:" + strings.Repeat("a", 64)))
+			Expect(redisContainer.ImagePullPolicy).To(Equal(corev1.PullIfNotPresent))
+			Expect(redisContainer.Resources.Limits.Memory().String()).To(Equal("256Mi"))
+			Expect(redisDeployment.Spec.Template.Spec.Volumes).To(ContainElement(HaveField("ConfigMap.Name", config.Name)))
+			configChecksum := redisDeployment.Spec.Template.Annotations[AnnotationRedisConfigChecksum]
+			Expect(configChecksum).NotTo(BeEmpty())
+
+			By("changing the config")
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: pira.Namespace, Name: pira.Name}, pira)).To(Succeed())
+			pira.Spec.Redis.Config["maxmemory"] = "200mb"
+			Expect(k8sClient.Update(ctx, pira)).To(Succeed())
+			mustReconcile()
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(&config), &config)).To(BeNil())
+			Expect(config.Data["redis.conf"]).To(ContainSubstring("maxmemory 200mb\n"))
+			Expect(k8sClient.Get(ctx, redisNn, &redisDeployment)).To(BeNil())
+			Expect(redisDeployment.Spec.Template.Annotations[AnnotationRedisConfigChecksum]).NotTo(Equal(configChecksum))
+		})
+
+		It("should serve Redis over TLS with a certificate issued by the operator", func() {
+			pira.Spec.Redis.Enabled = true
+			pira.Spec.Redis.TLS.Enabled = true
+			createApp()
+			markRedisReady()
+			result := mustReconcile()
+			Expect(result.RequeueAfter).To(BeNumerically(">", 200*24*time.Hour))
+
+			var ca, cert corev1.Secret
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: pira.Namespace, Name: pira.Name + "-redis-ca"}, &ca)).To(BeNil())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: pira.Namespace, Name: pira.Name + "-redis-tls"}, &cert)).To(BeNil())
+			Expect(cert.Data["ca.crt"]).To(Equal(ca.Data["tls.crt"]))
+			_, err := validCert(keyPair{cert: cert.Data["tls.crt"], key: cert.Data["tls.key"]}, cert.Data["ca.crt"], redisDNSNames(pira))
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(BeNil())
-			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoService)).To(BeNil())
 			Expect(k8sClient.Get(ctx, redisNn, &redisDeployment)).To(BeNil())
 			Expect(k8sClient.Get(ctx, redisNn, &redisService)).To(BeNil())
+			Expect(redisDeployment.Spec.Template.Spec.Containers[0].Command).To(ContainElements("--tls-port", "--port", "0"))
+			Expect(redisDeployment.Spec.Template.Spec.Volumes).To(ContainElement(HaveField("Secret.SecretName", cert.Name)))
+			Expect(*redisService.Spec.Ports[0].AppProtocol).To(Equal("rediss"))
+			podInfoChecksum := podInfoDeployment.Spec.Template.Annotations[AnnotationRedisTLSChecksum]
+			redisChecksum := redisDeployment.Spec.Template.Annotations[AnnotationRedisTLSChecksum]
+			Expect(podInfoChecksum).NotTo(BeEmpty())
+			Expect(redisChecksum).NotTo(BeEmpty())
 
-			pira.Spec.Redis.Enabled = false
-			Expect(k8sClient.Update(ctx, pira)).To(BeNil())
-			_, err = reconciler.Reconcile(ctx, reconcile.Request{
-				NamespacedName: types.NamespacedName{Namespace: pira.ObjectMeta.Namespace, Name: pira.ObjectMeta.Name},
-			})
-
+			By("reissuing a certificate whose key doesn't match it")
+			cert.Data["tls.key"] = ca.Data["tls.key"]
+			Expect(k8sClient.Update(ctx, &cert)).To(Succeed())
+			_, err = validCert(keyPair{cert: cert.Data["tls.crt"], key: cert.Data["tls.key"]}, cert.Data["ca.crt"], redisDNSNames(pira))
+			Expect(err).To(HaveOccurred())
+			mustReconcile()
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(&cert), &cert)).To(Succeed())
+			_, err = validCert(keyPair{cert: cert.Data["tls.crt"], key: cert.Data["tls.key"]}, cert.Data["ca.crt"], redisDNSNames(pira))
 			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, redisNn, &redisDeployment)).To(BeNil())
+			Expect(redisDeployment.Spec.Template.Annotations[AnnotationRedisTLSChecksum]).NotTo(Equal(redisChecksum))
+			redisChecksum = redisDeployment.Spec.Template.Annotations[AnnotationRedisTLSChecksum]
+
+			By("reissuing the certificate from a new CA when the CA is lost")
+			Expect(k8sClient.Delete(ctx, &ca)).To(Succeed())
+			mustReconcile()
 			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(BeNil())
-			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoService)).To(BeNil())
+			Expect(k8sClient.Get(ctx, redisNn, &redisDeployment)).To(BeNil())
+			Expect(podInfoDeployment.Spec.Template.Annotations[AnnotationRedisTLSChecksum]).NotTo(Equal(podInfoChecksum))
+			Expect(redisDeployment.Spec.Template.Annotations[AnnotationRedisTLSChecksum]).NotTo(Equal(redisChecksum))
+
+			By("disabling TLS")
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: pira.Namespace, Name: pira.Name}, pira)).To(Succeed())
+			pira.Spec.Redis.TLS.Enabled = false
+			Expect(k8sClient.Update(ctx, pira)).To(Succeed())
+			mustReconcile()
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(&cert), &corev1.Secret{}))).To(BeTrue())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(&ca), &corev1.Secret{}))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, redisNn, &redisDeployment)).To(BeNil())
+			Expect(redisDeployment.Spec.Template.Spec.Containers[0].Command).NotTo(ContainElement("--tls-port"))
+		})
+
+		It("should point PodInfo at an external Redis and report whether it is reachable", func() {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: pira.Namespace, Name: "external-redis"},
+				StringData: map[string]string{"password": "hunter2/@:%"},
+			}
+			Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+			pira.Spec.Redis.External = &v1.ExternalRedis{
+				Address: listener.Addr().String(),
+				TLS:     true,
+				PasswordSecret: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: secret.Name},
+					Key:                  "password",
+				},
+				ReachabilityCheck: true,
+			}
+			result := createApp()
+			Expect(result.RequeueAfter).To(Equal(reachabilityCheckInterval))
+
 			Expect(errors.IsNotFound(k8sClient.Get(ctx, redisNn, &appsv1.Deployment{}))).To(BeTrue())
 			Expect(errors.IsNotFound(k8sClient.Get(ctx, redisNn, &corev1.Service{}))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, podInfoNn, &podInfoDeployment)).To(BeNil())
+			env := lo.SliceToMap(podInfoDeployment.Spec.Template.Spec.Containers[0].Env, func(e corev1.EnvVar) (string, corev1.EnvVar) {
+				return e.Name, e
+			})
+			Expect(env["REDIS_PASSWORD"].ValueFrom.SecretKeyRef).To(Equal(lo.ToPtr(pira.PodInfoRedisPasswordSecretKeySelector())))
+			Expect(env["PODINFO_CACHE_SERVER"].Value).To(Equal("rediss://:$(REDIS_PASSWORD)@" + listener.Addr().String()))
+			// The password is percent-encoded for the cache server URL.
+			podInfoSecret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira.PodInfoRedisPasswordSecret(nil)), podInfoSecret)).To(Succeed())
+			Expect(string(podInfoSecret.Data["password"])).To(Equal("hunter2%2F%40%3A%25"))
+			Expect(podInfoDeployment.Spec.Template.Annotations[AnnotationRedisAuthChecksum]).NotTo(BeEmpty())
+			Expect(redisSecretNames(pira)).To(Equal([]string{secret.Name}))
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: pira.Namespace, Name: pira.Name}, pira)).To(Succeed())
+			Expect(meta.FindStatusCondition(pira.Status.Conditions, v1.ConditionRedisReachable).Status).To(Equal(metav1.ConditionTrue))
+			Expect(pira.Status.Redis).To(BeNil())
+
+			By("closing the listener")
+			Expect(listener.Close()).To(Succeed())
+			mustReconcile()
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: pira.Namespace, Name: pira.Name}, pira)).To(Succeed())
+			Expect(meta.FindStatusCondition(pira.Status.Conditions, v1.ConditionRedisReachable).Reason).To(Equal("Unreachable"))
+			Expect(meta.IsStatusConditionTrue(pira.Status.Conditions, v1.ConditionReady)).To(BeFalse())
+
+			By("switching to an operator-managed Redis")
+			pira.Spec.Redis.External = nil
+			pira.Spec.Redis.Enabled = true
+			Expect(k8sClient.Update(ctx, pira)).To(Succeed())
+			mustReconcile()
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: pira.Namespace, Name: pira.Name}, pira)).To(Succeed())
+			Expect(meta.FindStatusCondition(pira.Status.Conditions, v1.ConditionRedisReachable)).To(BeNil())
+			Expect(k8sClient.Delete(ctx, secret)).To(Succeed())
 		})
 
-		AfterEach(func() {
-			// Validate PodInfo Deployment
-			Expect(podInfoDeployment.OwnerReferences[0].UID).To(Equal(pira.UID))
-			Expect(*podInfoDeployment.Spec.Replicas).To(Equal(*pira.Spec.ReplicaCount))
-			// Ordered env var checking - if I had time I would use a map to avoid ordering constraints, which aren't necessary
-			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Env[0].Name).To(Equal("PODINFO_UI_COLOR"))
-			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Env[0].Value).To(Equal(pira.Spec.UI.Color))
-			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Env[1].Name).To(Equal("PODINFO_UI_MESSAGE"))
-			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Env[1].Value).To(Equal(pira.Spec.UI.Message))
-			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Env[2].Name).To(Equal("PODINFO_CACHE_SERVER"))
-			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Env[2].Value).To(Equal(fmt.Sprintf("tcp://%v-redis:6379", pira.Name)))
-
-			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Ports[0].ContainerPort).To(Equal(int32(9898)))
-			Expect(podInfoDeployment.Spec.Template.Spec.Containers[0].Ports[0].Protocol).To(Equal(corev1.ProtocolTCP))
-
-			Expect(*podInfoDeployment.Spec.Template.Spec.Containers[0].Resources.Limits.Memory()).To(Equal(pira.Spec.Resources.MemoryLimit))
-			Expect(*podInfoDeployment.Spec.Template.Spec.Containers[0].Resources.Requests.Cpu()).To(Equal(pira.Spec.Resources.CpuRequest))
-
-			// Validate PodInfo Service
-			Expect(podInfoService.OwnerReferences[0].UID).To(Equal(pira.UID))
-			Expect(podInfoService.Spec.Selector).To(Equal(podInfoDeployment.Spec.Selector.MatchLabels))
-			Expect(podInfoService.Spec.Ports[0].Port).To(Equal(int32(9898)))
-
-			// Validate Redis Deployment
-			Expect(redisDeployment.OwnerReferences[0].UID).To(Equal(pira.UID))
-			Expect(redisDeployment.Spec.Template.Spec.Containers[0].Ports[0].Name).To(Equal("redis"))
-			Expect(redisDeployment.Spec.Template.Spec.Containers[0].Ports[0].ContainerPort).To(Equal(int32(6379)))
-			Expect(redisDeployment.Spec.Template.Spec.Containers[0].Ports[0].Protocol).To(Equal(corev1.ProtocolTCP))
-
-			// Validate Redis Service
-			Expect(redisService.OwnerReferences[0].UID).To(Equal(pira.UID))
-			Expect(redisService.Spec.Selector).To(Equal(redisDeployment.Spec.Selector.MatchLabels))
-			Expect(redisService.Spec.Ports[0].Port).To(Equal(int32(6379)))
-			Expect(redisService.Spec.Ports[0].TargetPort.StrVal).To(Equal("redis"))
+		It("should route PodInfo to the primary Sentinel reports", func() {
+			pira.Spec.Redis.Enabled = true
+			pira.Spec.Redis.Mode = v1.RedisModeSentinel
+			Expect(k8sClient.Create(ctx, pira)).To(BeNil())
+			primary := fmt.Sprintf("%v-redis-node-1", pira.Name)
+			host := pira.RedisNodeHost(primary)
+			redis := &fakeRedis{replies: map[string]string{
+				"AUTH":     "+OK\r\n",
+				"SENTINEL": fmt.Sprintf("*2\r\n$%d\r\n%v\r\n$4\r\n6379\r\n", len(host), host),
+			}}
+			reconciler.RedisDialer = redis
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Namespace: pira.Namespace, Name: primary},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "redis", Image: "redis"}}},
+			}
+			Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+			mustReconcile()
+			Expect(redis.addresses).To(Equal([]string{pira.Name + "-redis-sentinel.default.svc:26379"}))
+
+			var nodes, sentinels appsv1.StatefulSet
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: pira.Namespace, Name: pira.Name + "-redis-node"}, &nodes)).To(BeNil())
+			Expect(*nodes.Spec.Replicas).To(Equal(int32(3)))
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: pira.Namespace, Name: pira.Name + "-redis-sentinel"}, &sentinels)).To(BeNil())
+			Expect(*sentinels.Spec.Replicas).To(Equal(int32(3)))
+			markStatefulSetRolledOut(&nodes)
+			mustReconcile()
+			By("reporting Redis unavailable until its Sentinels are")
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			available := meta.FindStatusCondition(pira.Status.Conditions, v1.ConditionRedisAvailable)
+			Expect(available.Status).To(Equal(metav1.ConditionUnknown))
+			Expect(available.Message).To(ContainSubstring(sentinels.Name))
+			Expect(meta.IsStatusConditionTrue(pira.Status.Conditions, v1.ConditionReady)).To(BeFalse())
+
+			markStatefulSetRolledOut(&sentinels)
+			result := mustReconcile()
+			Expect(result.RequeueAfter).To(Equal(sentinelPollInterval))
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(pira.Status.Conditions, v1.ConditionRedisAvailable)).To(BeTrue())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: pira.Namespace, Name: pira.Name + "-redis-headless"}, &corev1.Service{})).To(BeNil())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: pira.Namespace, Name: pira.Name + "-redis-sentinel"}, &corev1.Service{})).To(BeNil())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, redisNn, &appsv1.Deployment{}))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, redisNn, &redisService)).To(BeNil())
+			Expect(redisService.Spec.Selector).To(HaveKeyWithValue(v1.RedisRoleLabel, v1.RedisRolePrimary))
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), pod)).To(Succeed())
+			Expect(pod.Labels).To(HaveKeyWithValue(v1.RedisRoleLabel, v1.RedisRolePrimary))
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: pira.Namespace, Name: pira.Name}, pira)).To(Succeed())
+			Expect(pira.Status.RedisPrimary).To(Equal(primary))
+
+			By("keeping the last known primary while Sentinel can't be reached")
+			redis.err = fmt.Errorf("connection refused")
+			mustReconcile()
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: pira.Namespace, Name: pira.Name}, pira)).To(Succeed())
+			Expect(pira.Status.RedisPrimary).To(Equal(primary))
+
+			By("switching back to a standalone Redis")
+			pira.Spec.Redis.Mode = v1.RedisModeStandalone
+			Expect(k8sClient.Update(ctx, pira)).To(Succeed())
+			mustReconcile()
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(&nodes), &appsv1.StatefulSet{}))).To(BeTrue())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(&sentinels), &appsv1.StatefulSet{}))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: pira.Namespace, Name: pira.Name}, pira)).To(Succeed())
+			Expect(pira.Status.RedisPrimary).To(BeEmpty())
+			Expect(k8sClient.Delete(ctx, pod)).To(Succeed())
+		})
+
+		It("should write any Redis password into the Sentinel config as Redis reads it", func() {
+			pira.Spec.Redis.Enabled = true
+			pira.Spec.Redis.Mode = v1.RedisModeSentinel
+			container := pira.RedisSentinelStatefulSet().Spec.Template.Spec.Containers[0]
+			Expect(container.Command[:2]).To(Equal([]string{"sh", "-c"}))
+
+			// The script is run in a directory of its own, with cat standing in for Sentinel and
+			// no other Sentinel reachable.
+			dir := GinkgoT().TempDir()
+			Expect(os.WriteFile(filepath.Join(dir, "redis-cli"), []byte("#!/bin/sh\nexit 1\n"), 0o755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "redis-sentinel"), []byte("#!/bin/sh\ncat \"$1\"\n"), 0o755)).To(Succeed())
+			script := strings.ReplaceAll(container.Command[2], "/data/", dir+"/")
+			cmd := exec.Command("sh", "-c", script)
+			cmd.Env = append(os.Environ(), "PATH="+dir+":"+os.Getenv("PATH"), `REDISCLI_AUTH=hunter 2 "\`)
+			out, err := cmd.Output()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(out)).To(ContainSubstring(`sentinel auth-pass primary "hunter 2 \"\\"` + "\n"))
+			Expect(string(out)).To(ContainSubstring(`requirepass "hunter 2 \"\\"` + "\n"))
+		})
+
+		It("should retain the Redis claims and generated Secrets when deleted", func() {
+			redis := &fakeRedis{replies: map[string]string{"AUTH": "+OK\r\n", "SAVE": "+OK\r\n"}}
+			reconciler.RedisDialer = redis
+			pira.Spec.Redis.Enabled = true
+			pira.Spec.Redis.Persistence = &v1.Persistence{
+				Size:             resource.MustParse("1Gi"),
+				RetentionPolicy:  appsv1.DeletePersistentVolumeClaimRetentionPolicyType,
+				SnapshotOnDelete: true,
+			}
+			createApp()
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			Expect(pira.Finalizers).To(ContainElement(Finalizer))
+
+			By("running Redis with a claim, which its StatefulSet would own")
+			sts := appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, redisNn, &sts)).To(Succeed())
+			claim := &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: pira.Namespace,
+					Name:      "data-" + sts.Name + "-0",
+					Labels:    sts.Spec.Selector.MatchLabels,
+					OwnerReferences: []metav1.OwnerReference{{
+						APIVersion: "apps/v1", Kind: "StatefulSet", Name: sts.Name, UID: sts.UID,
+					}},
+				},
+				Spec: sts.Spec.VolumeClaimTemplates[0].Spec,
+			}
+			Expect(k8sClient.Create(ctx, claim)).To(Succeed())
 
-			By("Cleanup the specific resource instance PodInfoRedisApplication")
 			Expect(k8sClient.Delete(ctx, pira)).To(Succeed())
-			Expect(k8sClient.Delete(ctx, &podInfoDeployment)).To(Succeed())
-			Expect(k8sClient.Delete(ctx, &podInfoService)).To(Succeed())
-			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, &redisDeployment))).To(Succeed())
-			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, &redisService))).To(Succeed())
+			mustReconcile()
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), &v1.PodInfoRedisApplication{}))).To(BeTrue())
+			Expect(redis.addresses).To(Equal([]string{sts.Name + ".default.svc:6379"}))
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, podInfoNn, &appsv1.Deployment{}))).To(BeTrue())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, redisNn, &appsv1.StatefulSet{}))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(claim), claim)).To(Succeed())
+			Expect(claim.OwnerReferences).To(BeEmpty())
+			secret := pira.RedisAuthSecret(nil)
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(secret), secret)).To(Succeed())
+			Expect(secret.OwnerReferences).To(BeEmpty())
+			events := drainEvents(recorder)
+			Expect(events).To(ContainElements(
+				"Normal Released Released Secret "+secret.Name+", which outlives the application",
+				"Normal Deleted Deleted StatefulSet "+sts.Name,
+			))
+			Expect(events).NotTo(ContainElement(HavePrefix("Warning SnapshotFailed")))
+			// The API server protects claims with a finalizer, which no controller removes here.
+			claim.Finalizers = nil
+			Expect(k8sClient.Update(ctx, claim)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, claim)).To(Succeed())
+		})
+
+		It("should delete the Redis claims when deleted under the Delete policy", func() {
+			redis := &fakeRedis{}
+			reconciler.RedisDialer = redis
+			pira.Spec.Redis.Enabled = true
+			pira.Spec.Redis.Persistence = &v1.Persistence{Size: resource.MustParse("1Gi"), SnapshotOnDelete: true}
+			pira.Spec.DeletionPolicy = v1.DeletionPolicyDelete
+			createApp()
+			sts := appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, redisNn, &sts)).To(Succeed())
+			claim := &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{Namespace: pira.Namespace, Name: "data-" + sts.Name + "-0", Labels: sts.Spec.Selector.MatchLabels},
+				Spec:       sts.Spec.VolumeClaimTemplates[0].Spec,
+			}
+			Expect(k8sClient.Create(ctx, claim)).To(Succeed())
+
+			By("switching to a standalone Redis without persistence, keeping the claim")
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), pira)).To(Succeed())
+			pira.Spec.Redis.Persistence = nil
+			Expect(k8sClient.Update(ctx, pira)).To(Succeed())
+			mustReconcile()
+			Expect(k8sClient.Get(ctx, redisNn, &redisDeployment)).To(BeNil())
+
+			Expect(k8sClient.Delete(ctx, pira)).To(Succeed())
+			mustReconcile()
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), &v1.PodInfoRedisApplication{}))).To(BeTrue())
+			Expect(redis.addresses).To(BeEmpty())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(claim), claim)).To(Succeed())
+			Expect(claim.DeletionTimestamp).NotTo(BeNil())
+			claim.Finalizers = nil
+			Expect(k8sClient.Update(ctx, claim)).To(Succeed())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira.RedisAuthSecret(nil)), &corev1.Secret{}))).To(BeTrue())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, redisNn, &appsv1.Deployment{}))).To(BeTrue())
+		})
+
+		It("should leave everything running when deleted under the Orphan policy", func() {
+			pira.Spec.Redis.Enabled = true
+			pira.Spec.DeletionPolicy = v1.DeletionPolicyOrphan
+			createApp()
+
+			Expect(k8sClient.Delete(ctx, pira)).To(Succeed())
+			mustReconcile()
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(pira), &v1.PodInfoRedisApplication{}))).To(BeTrue())
+			for _, obj := range []client.Object{&appsv1.Deployment{}, &corev1.Service{}} {
+				Expect(k8sClient.Get(ctx, podInfoNn, obj)).To(Succeed())
+				Expect(obj.GetOwnerReferences()).To(BeEmpty())
+				Expect(k8sClient.Get(ctx, redisNn, obj)).To(Succeed())
+				Expect(obj.GetOwnerReferences()).To(BeEmpty())
+			}
+			live := appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, podInfoNn, &live)).To(Succeed())
+			Expect(*live.Spec.Replicas).To(Equal(*pira.Spec.ReplicaCount))
+		})
+
+		AfterEach(func() {
+			By("Cleanup the specific resource instance PodInfoRedisApplication")
+			// No Deployment controller runs in envtest, so pods a test reported are cleared, as
+			// the teardown waits for PodInfo to scale down.
+			for _, d := range []*appsv1.Deployment{{ObjectMeta: metav1.ObjectMeta{Namespace: podInfoNn.Namespace, Name: podInfoNn.Name}}, pira.PodInfoCanaryDeployment()} {
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(d), d); err == nil && d.Status.Replicas > 0 {
+					d.Status = appsv1.DeploymentStatus{}
+					Expect(k8sClient.Status().Update(ctx, d)).To(Succeed())
+				}
+			}
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, pira))).To(Succeed())
+			// Without a running controller, the finalizer is only removed by reconciling.
+			mustReconcile()
+			// Nor does the garbage collector run, so neither what the teardown keeps nor what it
+			// leaves to the garbage collector is deleted.
+			for _, obj := range ownedCandidates(pira) {
+				if err := k8sClient.Delete(ctx, obj); !errors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+					Expect(err).NotTo(HaveOccurred())
+				}
+			}
+			Expect(k8sClient.DeleteAllOf(ctx, &appsv1.ReplicaSet{}, client.InNamespace(pira.Namespace))).To(Succeed())
 		})
 	})
 })
+
+// fakeRedis serves connections as Redis would, answering each command with the reply in
+// the Redis protocol listed under its name, and records the addresses dialed. While err is
+// set, dialing fails with it.
+type fakeRedis struct {
+	replies   map[string]string
+	err       error
+	addresses []string
+}
+
+func (f *fakeRedis) DialContext(_ context.Context, _, address string) (net.Conn, error) {
+	f.addresses = append(f.addresses, address)
+	if f.err != nil {
+		return nil, f.err
+	}
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		r := bufio.NewReader(server)
+		for {
+			// A command is sent as an array of bulk strings, which reads like a reply.
+			command, err := readRedisReply(r)
+			if err != nil || len(command) == 0 {
+				return
+			}
+			reply, ok := f.replies[strings.ToUpper(command[0])]
+			if !ok {
+				reply = "-ERR unknown command\r\n"
+			}
+			if _, err := server.Write([]byte(reply)); err != nil {
+				return
+			}
+		}
+	}()
+	return client, nil
+}
+
+// fakeHealthChecker records the URLs it checks, and fails them with err.
+type fakeHealthChecker struct {
+	err  error
+	urls []string
+}
+
+func (c *fakeHealthChecker) Check(_ context.Context, url string) error {
+	c.urls = append(c.urls, url)
+	return c.err
+}
+
+// markRolledOut reports every replica of d as updated and available, as the Deployment
+// controller, which doesn't run in envtest, would.
+func markRolledOut(d *appsv1.Deployment) {
+	Expect(k8sClient.Get(context.Background(), client.ObjectKeyFromObject(d), d)).To(Succeed())
+	d.Status.ObservedGeneration = d.Generation
+	d.Status.Replicas = *d.Spec.Replicas
+	d.Status.UpdatedReplicas = *d.Spec.Replicas
+	d.Status.ReadyReplicas = *d.Spec.Replicas
+	d.Status.AvailableReplicas = *d.Spec.Replicas
+	Expect(k8sClient.Status().Update(context.Background(), d)).To(Succeed())
+}
+
+// markStatefulSetRolledOut has sts report its replicas ready on its current revision, as the
+// StatefulSet controller, which doesn't run in envtest, would.
+func markStatefulSetRolledOut(sts *appsv1.StatefulSet) {
+	Expect(k8sClient.Get(context.Background(), client.ObjectKeyFromObject(sts), sts)).To(Succeed())
+	sts.Status.ObservedGeneration = sts.Generation
+	sts.Status.Replicas = *sts.Spec.Replicas
+	sts.Status.ReadyReplicas = *sts.Spec.Replicas
+	sts.Status.AvailableReplicas = *sts.Spec.Replicas
+	sts.Status.UpdatedReplicas = *sts.Spec.Replicas
+	sts.Status.CurrentRevision = sts.Name + "-1"
+	sts.Status.UpdateRevision = sts.Name + "-1"
+	Expect(k8sClient.Status().Update(context.Background(), sts)).To(Succeed())
+}
+
+// setRevision numbers the current template of d as revision, and creates its ReplicaSet with
+// available pods, as the Deployment controller, which doesn't run in envtest, would.
+func setRevision(d *appsv1.Deployment, revision string, available int32) {
+	ctx := context.Background()
+	Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(d), d)).To(Succeed())
+	d.Annotations[revisionAnnotation] = revision
+	Expect(k8sClient.Update(ctx, d)).To(Succeed())
+
+	// Like the Deployment controller, tell the ReplicaSet apart by a pod-template-hash label.
+	template := *d.Spec.Template.DeepCopy()
+	template.Labels = lo.Assign(template.Labels, map[string]string{appsv1.DefaultDeploymentUniqueLabelKey: revision})
+	selector := d.Spec.Selector.DeepCopy()
+	selector.MatchLabels = lo.Assign(selector.MatchLabels, map[string]string{appsv1.DefaultDeploymentUniqueLabelKey: revision})
+	replicaSet := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   d.Namespace,
+			Name:        fmt.Sprintf("%v-%v", d.Name, revision),
+			Labels:      template.Labels,
+			Annotations: map[string]string{revisionAnnotation: revision},
+		},
+		Spec: appsv1.ReplicaSetSpec{Replicas: d.Spec.Replicas, Selector: selector, Template: template},
+	}
+	Expect(controllerutil.SetControllerReference(d, replicaSet, k8sClient.Scheme())).To(Succeed())
+	Expect(k8sClient.Create(ctx, replicaSet)).To(Succeed())
+	replicaSet.Status = appsv1.ReplicaSetStatus{Replicas: available, ReadyReplicas: available, AvailableReplicas: available}
+	Expect(k8sClient.Status().Update(ctx, replicaSet)).To(Succeed())
+}
+
+// drainEvents returns the events recorded since it was last called.
+func drainEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
@@ -0,0 +1,336 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	v1 "neeraj.angi/app-operator/api/v1"
+)
+
+// AnnotationRedisAuthChecksum is set on the pod templates of PodInfo and Redis, so that they
+// roll out together when the Redis password changes.
+var AnnotationRedisAuthChecksum = fmt.Sprintf("%v/redis-auth-checksum", v1.GroupVersion.Group)
+
+// AnnotationRedisConfigChecksum is set on the Redis pod template, so that Redis rolls out when
+// its config changes. The ConfigMap is mounted as a directory, which the kubelet updates in
+// place, but Redis only reads it on start.
+var AnnotationRedisConfigChecksum = fmt.Sprintf("%v/redis-config-checksum", v1.GroupVersion.Group)
+
+// AnnotationRedisTLSChecksum is set on the pod templates of PodInfo and Redis, so that each
+// rolls out when the certificates it uses change.
+var AnnotationRedisTLSChecksum = fmt.Sprintf("%v/redis-tls-checksum", v1.GroupVersion.Group)
+
+// checksumKeyKey is the key of the Secret PodInfo reads the Redis password from that holds the
+// random key AnnotationRedisAuthChecksum is an HMAC under. Pod templates are readable by more
+// than Secrets are, and a plain hash of a password can be tested against guesses.
+const checksumKeyKey = "checksum-key"
+
+// redisSecretsField indexes applications by the user-supplied Secrets they configure Redis with.
+const redisSecretsField = ".spec.redis.existingSecrets"
+
+// caCertKey is the Secret key holding the CA certificate that issued a kubernetes.io/tls
+// Secret's certificate.
+const caCertKey = "ca.crt"
+
+// redisPassword returns the Redis password of pira. Unless pira references an existing Secret,
+// it also returns the generated Secret to apply, with a new password if there was none yet.
+func (r *PodInfoRedisApplicationReconciler) redisPassword(ctx context.Context, pira *v1.PodInfoRedisApplication) ([]byte, *corev1.Secret, error) {
+	ref := pira.RedisPasswordSecretKeySelector()
+	if pira.Spec.Redis.Auth.ExistingSecret != nil {
+		password, err := r.secretKey(ctx, pira.Namespace, ref)
+		return password, nil, err
+	}
+
+	var secret corev1.Secret
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: pira.Namespace, Name: ref.Name}, &secret); client.IgnoreNotFound(err) != nil {
+		return nil, nil, fmt.Errorf("getting Redis password Secret: %v", err)
+	}
+	password := secret.Data[ref.Key]
+	if len(password) == 0 {
+		var err error
+		if password, err = generatePassword(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return password, pira.RedisAuthSecret(password), nil
+}
+
+// podInfoRedisPasswordSecret returns the Secret PodInfo reads password from, and the checksum
+// of password the pod templates are annotated with. The key of the checksum is kept in the
+// Secret, and a new one generated if it is deleted.
+func (r *PodInfoRedisApplicationReconciler) podInfoRedisPasswordSecret(ctx context.Context, pira *v1.PodInfoRedisApplication, password []byte) (*corev1.Secret, string, error) {
+	secret := pira.PodInfoRedisPasswordSecret(password)
+	var live corev1.Secret
+	if err := r.Client.Get(ctx, client.ObjectKeyFromObject(secret), &live); client.IgnoreNotFound(err) != nil {
+		return nil, "", fmt.Errorf("getting PodInfo Redis password Secret: %v", err)
+	}
+	key := live.Data[checksumKeyKey]
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, "", fmt.Errorf("generating checksum key: %v", err)
+		}
+	}
+	secret.Data[checksumKeyKey] = key
+	mac := hmac.New(sha256.New, key)
+	mac.Write(password)
+	return secret, hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// secretKey returns the value of a key of a user-supplied Secret, which must be set.
+func (r *PodInfoRedisApplicationReconciler) secretKey(ctx context.Context, namespace string, ref corev1.SecretKeySelector) ([]byte, error) {
+	var secret corev1.Secret
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, &secret); err != nil {
+		return nil, fmt.Errorf("getting Secret: %v", err)
+	}
+	value := secret.Data[ref.Key]
+	if len(value) == 0 {
+		return nil, fmt.Errorf("secret %v has no %v key", ref.Name, ref.Key)
+	}
+	return value, nil
+}
+
+// reachabilityCheckInterval is how often an external Redis is checked for reachability.
+const reachabilityCheckInterval = time.Minute
+
+// redisHandoverInterval is how often PodInfo is checked while it is handed over to or from
+// the managed Redis.
+const redisHandoverInterval = 10 * time.Second
+
+// redisPending reports whether the managed Redis, which PodInfo isn't using yet, isn't ready
+// to serve it.
+func (r *PodInfoRedisApplicationReconciler) redisPending(ctx context.Context, pira *v1.PodInfoRedisApplication, observed *observedState) (bool, error) {
+	podInfo, err := r.getDeployment(ctx, observed.podInfo)
+	if err != nil {
+		return false, err
+	}
+	if podInfo != nil && usesManagedRedis(pira, podInfo) {
+		return false, nil
+	}
+	if observed.redis != nil {
+		redis, err := r.getDeployment(ctx, observed.redis)
+		return redis == nil || !rolloutComplete(redis), err
+	}
+	for _, sts := range lo.Compact([]*appsv1.StatefulSet{observed.redisStatefulSet, observed.redisSentinel}) {
+		live := &appsv1.StatefulSet{}
+		err := r.Client.Get(ctx, client.ObjectKeyFromObject(sts), live)
+		if client.IgnoreNotFound(err) != nil {
+			return false, fmt.Errorf("getting %v: %v", sts.Name, err)
+		}
+		if err != nil || !statefulSetRolloutComplete(live) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// usesManagedRedis reports whether the pods of d are given the managed Redis as their cache
+// server.
+func usesManagedRedis(pira *v1.PodInfoRedisApplication, d *appsv1.Deployment) bool {
+	env, ok := lo.Find(d.Spec.Template.Spec.Containers[0].Env, func(e corev1.EnvVar) bool {
+		return e.Name == "PODINFO_CACHE_SERVER"
+	})
+	return ok && strings.HasSuffix(env.Value, "@"+pira.ManagedRedisAddress())
+}
+
+// podInfoRolledOut reports whether the pods of PodInfo, and of its canary if any, all run the
+// templates of observed, as applied.
+func podInfoRolledOut(observed *observedState) bool {
+	return rolloutComplete(observed.podInfo) && (observed.podInfoCanary == nil || rolloutComplete(observed.podInfoCanary))
+}
+
+// redisReachableCondition reports whether a TCP connection to address can be opened.
+func redisReachableCondition(ctx context.Context, address string) metav1.Condition {
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return metav1.Condition{
+			Type:    v1.ConditionRedisReachable,
+			Status:  metav1.ConditionFalse,
+			Reason:  "Unreachable",
+			Message: err.Error(),
+		}
+	}
+	conn.Close()
+	return metav1.Condition{
+		Type:    v1.ConditionRedisReachable,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Reachable",
+		Message: fmt.Sprintf("Connected to %v", address),
+	}
+}
+
+// generatePassword returns a random password that can be used in a URL without escaping.
+func generatePassword() ([]byte, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("generating password: %v", err)
+	}
+	return []byte(hex.EncodeToString(b)), nil
+}
+
+func checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// redisTLS returns the data of the Secret holding the Redis certificate. Unless pira references
+// an existing Secret, the certificate is issued by the operator's own CA; the CA and certificate
+// Secrets to apply are returned too, along with when the next renewal is due.
+func (r *PodInfoRedisApplicationReconciler) redisTLS(ctx context.Context, pira *v1.PodInfoRedisApplication) (map[string][]byte, []client.Object, time.Time, error) {
+	if name := pira.Spec.Redis.TLS.ExistingSecret; name != "" {
+		var secret corev1.Secret
+		if err := r.Client.Get(ctx, client.ObjectKey{Namespace: pira.Namespace, Name: name}, &secret); err != nil {
+			return nil, nil, time.Time{}, fmt.Errorf("getting Redis TLS Secret: %v", err)
+		}
+		for _, key := range []string{corev1.TLSCertKey, corev1.TLSPrivateKeyKey, caCertKey} {
+			if len(secret.Data[key]) == 0 {
+				return nil, nil, time.Time{}, fmt.Errorf("secret %v has no %v key", name, key)
+			}
+		}
+		return secret.Data, nil, time.Time{}, nil
+	}
+
+	now := time.Now()
+	caSecret, certSecret := pira.RedisCASecret(nil), pira.RedisTLSSecret(nil)
+	for _, secret := range []*corev1.Secret{caSecret, certSecret} {
+		if err := r.Client.Get(ctx, client.ObjectKeyFromObject(secret), secret); client.IgnoreNotFound(err) != nil {
+			return nil, nil, time.Time{}, fmt.Errorf("getting Redis TLS Secret: %v", err)
+		}
+	}
+
+	ca := keyPair{cert: caSecret.Data[corev1.TLSCertKey], key: caSecret.Data[corev1.TLSPrivateKeyKey]}
+	caRenewal, err := validCert(ca, nil, nil)
+	if err != nil || !now.Before(caRenewal) {
+		if ca, err = newCA(caSecret.Name, now); err != nil {
+			return nil, nil, time.Time{}, err
+		}
+		if caRenewal, err = validCert(ca, nil, nil); err != nil {
+			return nil, nil, time.Time{}, err
+		}
+	}
+
+	// A renewed CA invalidates the certificate, since it no longer verifies against ca.crt.
+	dnsNames := redisDNSNames(pira)
+	cert := keyPair{cert: certSecret.Data[corev1.TLSCertKey], key: certSecret.Data[corev1.TLSPrivateKeyKey]}
+	certRenewal, err := validCert(cert, ca.cert, dnsNames)
+	if err != nil || !now.Before(certRenewal) {
+		if cert, err = issueCert(ca, dnsNames, now); err != nil {
+			return nil, nil, time.Time{}, err
+		}
+		if certRenewal, err = validCert(cert, ca.cert, dnsNames); err != nil {
+			return nil, nil, time.Time{}, err
+		}
+	}
+
+	data := map[string][]byte{corev1.TLSCertKey: cert.cert, corev1.TLSPrivateKeyKey: cert.key, caCertKey: ca.cert}
+	secrets := []client.Object{
+		pira.RedisCASecret(map[string][]byte{corev1.TLSCertKey: ca.cert, corev1.TLSPrivateKeyKey: ca.key}),
+		pira.RedisTLSSecret(data),
+	}
+	return data, secrets, lo.Ternary(caRenewal.Before(certRenewal), caRenewal, certRenewal), nil
+}
+
+// redisDNSNames are the names clients may address the Redis Service by, and in the replicated
+// and sentinel modes the names nodes and Sentinels address each other by.
+func redisDNSNames(pira *v1.PodInfoRedisApplication) []string {
+	services := []*corev1.Service{pira.RedisService()}
+	var names []string
+	switch pira.Spec.Redis.Mode {
+	case v1.RedisModeSentinel:
+		services = append(services, pira.RedisSentinelService())
+		fallthrough
+	case v1.RedisModeReplicated:
+		services = append(services, pira.RedisHeadlessService())
+	}
+	for _, service := range services {
+		names = append(names,
+			service.Name,
+			fmt.Sprintf("%v.%v", service.Name, service.Namespace),
+			fmt.Sprintf("%v.%v.svc", service.Name, service.Namespace),
+			fmt.Sprintf("%v.%v.svc.cluster.local", service.Name, service.Namespace),
+		)
+		if service.Spec.ClusterIP == corev1.ClusterIPNone {
+			names = append(names,
+				fmt.Sprintf("*.%v.%v.svc", service.Name, service.Namespace),
+				fmt.Sprintf("*.%v.%v.svc.cluster.local", service.Name, service.Namespace),
+			)
+		}
+	}
+	return names
+}
+
+// setPodTemplateAnnotation sets an annotation on the pod template of a Deployment or
+// StatefulSet, which rolls out its pods whenever the value changes.
+func setPodTemplateAnnotation(obj client.Object, key, value string) {
+	var template *corev1.PodTemplateSpec
+	switch obj := obj.(type) {
+	case *appsv1.Deployment:
+		template = &obj.Spec.Template
+	case *appsv1.StatefulSet:
+		template = &obj.Spec.Template
+	default:
+		return
+	}
+	template.Annotations = lo.Assign(template.Annotations, map[string]string{key: value})
+}
+
+// redisSecretNames is the index function for redisSecretsField.
+func redisSecretNames(obj client.Object) []string {
+	pira := obj.(*v1.PodInfoRedisApplication)
+	var names []string
+	if external := pira.Spec.Redis.External; external != nil && external.PasswordSecret != nil {
+		names = append(names, external.PasswordSecret.Name)
+	}
+	if !pira.Spec.Redis.Enabled {
+		return names
+	}
+	if ref := pira.Spec.Redis.Auth.ExistingSecret; ref != nil {
+		names = append(names, ref.Name)
+	}
+	if tls := pira.Spec.Redis.TLS; tls.Enabled && tls.ExistingSecret != "" {
+		names = append(names, tls.ExistingSecret)
+	}
+	return lo.Uniq(names)
+}
+
+// applicationsForSecret maps a Secret to the applications that configure Redis with it.
+func (r *PodInfoRedisApplicationReconciler) applicationsForSecret(ctx context.Context, secret client.Object) []reconcile.Request {
+	var piras v1.PodInfoRedisApplicationList
+	if err := r.Client.List(ctx, &piras, client.InNamespace(secret.GetNamespace()), client.MatchingFields{redisSecretsField: secret.GetName()}); err != nil {
+		return nil
+	}
+	return lo.Map(piras.Items, func(pira v1.PodInfoRedisApplication, _ int) reconcile.Request {
+		return reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&pira)}
+	})
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	v1 "neeraj.angi/app-operator/api/v1"
+)
+
+// sentinelPollInterval is how often the primary is looked up in the sentinel mode, bounding
+// how long PodInfo keeps connecting to a primary Sentinel has failed over from.
+const sentinelPollInterval = 30 * time.Second
+
+// RedisDialer opens the connections the operator sends commands to Redis and Sentinel over.
+// A *net.Dialer is one.
+type RedisDialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// redisCommand runs a command on the Redis or Sentinel at address and returns its reply. It
+// authenticates with the Redis password, and connects over TLS, trusting the CA of the Redis
+// certificate, while TLS is enabled.
+func (r *PodInfoRedisApplicationReconciler) redisCommand(ctx context.Context, pira *v1.PodInfoRedisApplication, address string, args ...string) ([]string, error) {
+	password, _, err := r.redisPassword(ctx, pira)
+	if err != nil {
+		return nil, err
+	}
+	var config *tls.Config
+	if pira.Spec.Redis.TLS.Enabled {
+		ca, err := r.secretKey(ctx, pira.Namespace, corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: pira.RedisTLSSecretName()},
+			Key:                  caCertKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("getting Redis CA certificate: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("parsing Redis CA certificate")
+		}
+		host, _, _ := net.SplitHostPort(address)
+		config = &tls.Config{RootCAs: pool, ServerName: host, MinVersion: tls.VersionTLS12}
+	}
+
+	dialer := r.RedisDialer
+	if dialer == nil {
+		dialer = &net.Dialer{Timeout: 5 * time.Second}
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, err
+		}
+	}
+	if config != nil {
+		conn = tls.Client(conn, config)
+	}
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	if _, err := redisRoundTrip(rw, "AUTH", string(password)); err != nil {
+		return nil, fmt.Errorf("authenticating: %v", err)
+	}
+	return redisRoundTrip(rw, args...)
+}
+
+// redisRoundTrip sends a command in the Redis protocol and reads its reply.
+func redisRoundTrip(rw *bufio.ReadWriter, args ...string) ([]string, error) {
+	fmt.Fprintf(rw, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(rw, "$%d\r\n%v\r\n", len(arg), arg)
+	}
+	if err := rw.Flush(); err != nil {
+		return nil, err
+	}
+	return readRedisReply(rw.Reader)
+}
+
+// readRedisReply reads a reply in the Redis protocol. A simple string, integer or bulk string
+// is returned as a single element, an array as its elements, and a nil reply as none.
+func readRedisReply(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("empty reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		return []string{line[1:]}, nil
+	case '-':
+		return nil, fmt.Errorf("%v", line[1:])
+	case '$', '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("unexpected reply %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		if line[0] == '$' {
+			b := make([]byte, n+2)
+			if _, err := io.ReadFull(r, b); err != nil {
+				return nil, err
+			}
+			return []string{string(b[:n])}, nil
+		}
+		var elems []string
+		for i := 0; i < n; i++ {
+			elem, err := readRedisReply(r)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, elem...)
+		}
+		return elems, nil
+	}
+	return nil, fmt.Errorf("unexpected reply %q", line)
+}
+
+// reconcileRedisPrimary finds the Redis primary of the replicated and sentinel modes and labels
+// its pod, so that the Redis Service routes PodInfo to it, removing the label from the others.
+// In the replicated mode the primary never changes. In the sentinel mode the Sentinels are
+// asked, keeping the last known primary while none of them answer.
+func (r *PodInfoRedisApplicationReconciler) reconcileRedisPrimary(ctx context.Context, pira *v1.PodInfoRedisApplication, observed *observedState) error {
+	primary := pira.RedisInitialPrimary()
+	if pira.Spec.Redis.Mode == v1.RedisModeSentinel {
+		if pira.Status.RedisPrimary != "" {
+			primary = pira.Status.RedisPrimary
+		}
+		if found, err := r.sentinelPrimary(ctx, pira); err != nil {
+			log.FromContext(ctx).V(1).Info("Keeping the last known Redis primary", "primary", primary, "reason", err.Error())
+		} else {
+			primary = found
+		}
+		observed.requeueWithin(sentinelPollInterval)
+	}
+	observed.redisPrimary = primary
+
+	// Patching labels by name rather than listing pods spares the operator a cache of every
+	// pod in the cluster. A patch that changes nothing leaves the pod untouched.
+	for i := int32(0); i < *observed.redisStatefulSet.Spec.Replicas; i++ {
+		pod := fmt.Sprintf("%v-%v", observed.redisStatefulSet.Name, i)
+		var role *string
+		if pod == primary {
+			role = lo.ToPtr(v1.RedisRolePrimary)
+		}
+		patch, err := json.Marshal(map[string]any{"metadata": map[string]any{"labels": map[string]*string{v1.RedisRoleLabel: role}}})
+		if err != nil {
+			return fmt.Errorf("labelling Redis primary: %v", err)
+		}
+		obj := &corev1.Pod{}
+		obj.Namespace, obj.Name = pira.Namespace, pod
+		if err := r.Client.Patch(ctx, obj, client.RawPatch(types.MergePatchType, patch)); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("labelling Redis primary: %v", err)
+		}
+	}
+	return nil
+}
+
+// sentinelPrimary asks a Sentinel, through the Sentinel Service, for the primary, returning
+// its pod name.
+func (r *PodInfoRedisApplicationReconciler) sentinelPrimary(ctx context.Context, pira *v1.PodInfoRedisApplication) (string, error) {
+	service := pira.RedisSentinelService()
+	address := fmt.Sprintf("%v.%v.svc:%v", service.Name, service.Namespace, service.Spec.Ports[0].Port)
+	cmdCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	reply, err := r.redisCommand(cmdCtx, pira, address, "SENTINEL", "get-master-addr-by-name", v1.RedisSentinelMaster)
+	if err != nil {
+		return "", fmt.Errorf("looking up Redis primary: %v", err)
+	}
+	// Answers are a node host, named after the pod, and a port.
+	if len(reply) == 2 {
+		if name, domain, _ := strings.Cut(reply[0], "."); pira.RedisNodeHost(name) == reply[0] && domain != "" {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("looking up Redis primary: unexpected reply %q", reply)
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/samber/lo"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	v1 "neeraj.angi/app-operator/api/v1"
+	"neeraj.angi/app-operator/util/kubeclient"
+)
+
+// revisionAnnotation numbers the revisions of a Deployment, on it and on its ReplicaSets.
+const revisionAnnotation = "deployment.kubernetes.io/revision"
+
+// autoRollback keeps track of the revisions of the PodInfo Deployment, recording the last one
+// that became available. Once a new revision has failed to become available within the
+// deadline, observed.podInfo is reverted to the pod template of that revision's ReplicaSet,
+// which it keeps until the spec changes the template.
+func (r *PodInfoRedisApplicationReconciler) autoRollback(ctx context.Context, pira *v1.PodInfoRedisApplication, observed *observedState) error {
+	if pira.Spec.Rollout.AutoRollback == nil {
+		observed.autoRollback = nil
+		return nil
+	}
+	status := &v1.AutoRollbackStatus{}
+	if pira.Status.AutoRollback != nil {
+		status = pira.Status.AutoRollback.DeepCopy()
+	}
+	observed.autoRollback = status
+
+	desiredChecksum, err := templateChecksum(observed.podInfo.Spec.Template)
+	if err != nil {
+		return err
+	}
+	if status.FailedTemplateChecksum != "" && status.FailedTemplateChecksum != desiredChecksum {
+		// The spec changed the template since, so it is rolled out again.
+		status.FailedRevision, status.FailedTemplateChecksum = "", ""
+	}
+	live, err := r.getDeployment(ctx, observed.podInfo)
+	if err != nil || live == nil {
+		return err
+	}
+	if status.FailedTemplateChecksum == "" {
+		if err := r.checkRevision(ctx, pira, status, live, observed); err != nil {
+			return err
+		}
+		if status.FailedRevision == "" {
+			return nil
+		}
+		status.FailedTemplateChecksum = desiredChecksum
+	}
+	knownGood, err := r.knownGoodReplicaSet(ctx, pira, status, live)
+	if err != nil || knownGood == nil {
+		return err
+	}
+	observed.podInfo.Spec.Template = podTemplateOf(knownGood)
+	return nil
+}
+
+// checkRevision records the current revision of live once it is available, and marks that
+// revision as failed once it has been unavailable for longer than the deadline.
+func (r *PodInfoRedisApplicationReconciler) checkRevision(ctx context.Context, pira *v1.PodInfoRedisApplication, status *v1.AutoRollbackStatus, live *appsv1.Deployment, observed *observedState) error {
+	revision := live.Annotations[revisionAnnotation]
+	if revision == "" {
+		// The Deployment controller hasn't seen the Deployment yet.
+		return nil
+	}
+	if revision != status.Revision {
+		status.Revision, status.RevisionTime = revision, lo.ToPtr(metav1.Now())
+	}
+	replicaSet, err := r.replicaSetOf(ctx, live, func(rs *appsv1.ReplicaSet) bool {
+		return rs.Annotations[revisionAnnotation] == revision
+	})
+	if err != nil {
+		return err
+	}
+	liveChecksum, err := templateChecksum(live.Spec.Template)
+	if err != nil {
+		return err
+	}
+	replicas := lo.FromPtrOr(live.Spec.Replicas, 1)
+	available := int32(0)
+	if replicaSet != nil {
+		available = replicaSet.Status.AvailableReplicas
+	}
+	if available >= replicas && rolloutComplete(live) {
+		status.KnownGoodRevision, status.KnownGoodTemplateChecksum = revision, liveChecksum
+		return nil
+	}
+	if status.KnownGoodTemplateChecksum == "" || status.KnownGoodTemplateChecksum == liveChecksum {
+		return nil
+	}
+	// A template the spec no longer asks for is replaced by the apply anyway.
+	drifted, err := kubeclient.HasDrifted(&corev1.PodTemplate{Template: observed.podInfo.Spec.Template}, &corev1.PodTemplate{Template: live.Spec.Template})
+	if err != nil || drifted {
+		return err
+	}
+	deadline := pira.Spec.Rollout.AutoRollback.Deadline()
+	if elapsed := time.Since(status.RevisionTime.Time); elapsed < deadline {
+		observed.requeueWithin(deadline - elapsed)
+		return nil
+	}
+	if knownGood, err := r.knownGoodReplicaSet(ctx, pira, status, live); err != nil || knownGood == nil {
+		return err
+	}
+	r.Recorder.Eventf(pira, corev1.EventTypeWarning, "RolledBack", "Reverted Deployment %v to its last available pod template, as %v of %v pods of revision %v were available after %v",
+		live.Name, available, replicas, revision, deadline)
+	status.FailedRevision = revision
+	return nil
+}
+
+// knownGoodReplicaSet returns the ReplicaSet of d running the known-good pod template of
+// status. Once that ReplicaSet is gone, such as past the revision history limit, it returns
+// nil and forgets the known-good revision, leaving the current one in place until another
+// becomes available.
+func (r *PodInfoRedisApplicationReconciler) knownGoodReplicaSet(ctx context.Context, pira *v1.PodInfoRedisApplication, status *v1.AutoRollbackStatus, d *appsv1.Deployment) (*appsv1.ReplicaSet, error) {
+	replicaSet, err := r.replicaSetOf(ctx, d, func(rs *appsv1.ReplicaSet) bool {
+		sum, err := templateChecksum(podTemplateOf(rs))
+		return err == nil && sum == status.KnownGoodTemplateChecksum
+	})
+	if err != nil || replicaSet != nil {
+		return replicaSet, err
+	}
+	r.Recorder.Eventf(pira, corev1.EventTypeWarning, "RollbackUnavailable", "Can't revert Deployment %v to revision %v, as its ReplicaSet is gone",
+		d.Name, status.KnownGoodRevision)
+	status.KnownGoodRevision, status.KnownGoodTemplateChecksum = "", ""
+	status.FailedRevision, status.FailedTemplateChecksum = "", ""
+	return nil, nil
+}
+
+// replicaSetOf returns the ReplicaSet of d that match accepts, or nil if there is none.
+func (r *PodInfoRedisApplicationReconciler) replicaSetOf(ctx context.Context, d *appsv1.Deployment, match func(*appsv1.ReplicaSet) bool) (*appsv1.ReplicaSet, error) {
+	replicaSets := &appsv1.ReplicaSetList{}
+	if err := r.Client.List(ctx, replicaSets, client.InNamespace(d.Namespace), client.MatchingLabels(d.Spec.Selector.MatchLabels)); err != nil {
+		return nil, fmt.Errorf("listing ReplicaSets of %v: %v", d.Name, err)
+	}
+	replicaSet, ok := lo.Find(replicaSets.Items, func(rs appsv1.ReplicaSet) bool {
+		return metav1.IsControlledBy(&rs, d) && match(&rs)
+	})
+	if !ok {
+		return nil, nil
+	}
+	return &replicaSet, nil
+}
+
+// podTemplateOf returns the pod template of the Deployment revision rs runs, without the
+// label the Deployment controller tells its ReplicaSets apart by.
+func podTemplateOf(rs *appsv1.ReplicaSet) corev1.PodTemplateSpec {
+	template := *rs.Spec.Template.DeepCopy()
+	delete(template.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+	return template
+}
+
+// templateChecksum returns the checksum of a pod template.
+func templateChecksum(template corev1.PodTemplateSpec) (string, error) {
+	data, err := json.Marshal(template)
+	if err != nil {
+		return "", fmt.Errorf("encoding pod template: %v", err)
+	}
+	return checksum(data), nil
+}
+
+// rolledBackCondition reports whether PodInfo runs its known-good template in place of the
+// one the spec asks for.
+func rolledBackCondition(status *v1.AutoRollbackStatus) metav1.Condition {
+	if status.FailedTemplateChecksum == "" {
+		return metav1.Condition{Type: v1.ConditionRolledBack, Status: metav1.ConditionFalse, Reason: "AsExpected"}
+	}
+	return metav1.Condition{
+		Type:    v1.ConditionRolledBack,
+		Status:  metav1.ConditionTrue,
+		Reason:  "RevisionUnavailable",
+		Message: fmt.Sprintf("Revision %v didn't become available, so PodInfo runs its last available pod template until the spec changes", status.FailedRevision),
+	}
+}
+
+// applicationForReplicaSet maps a ReplicaSet of the PodInfo Deployment to its application, so
+// that the availability of its revisions is tracked.
+func (r *PodInfoRedisApplicationReconciler) applicationForReplicaSet(ctx context.Context, replicaSet client.Object) []reconcile.Request {
+	ref := metav1.GetControllerOf(replicaSet)
+	if ref == nil || ref.Kind != "Deployment" {
+		return nil
+	}
+	deployment := &appsv1.Deployment{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Namespace: replicaSet.GetNamespace(), Name: ref.Name}, deployment); err != nil {
+		return nil
+	}
+	owner := metav1.GetControllerOf(deployment)
+	if owner == nil || owner.Kind != "PodInfoRedisApplication" || owner.APIVersion != v1.GroupVersion.String() {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: deployment.Namespace, Name: owner.Name}}}
+}
@@ -0,0 +1,290 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/samber/lo"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	v1 "neeraj.angi/app-operator/api/v1"
+)
+
+// maxRolloutHistory is the number of finished rollouts kept in status.
+const maxRolloutHistory = 10
+
+// canaryCheckInterval is how often a canary failing its check is checked again.
+const canaryCheckInterval = 10 * time.Second
+
+// HealthChecker checks that PodInfo answers at url.
+type HealthChecker interface {
+	Check(ctx context.Context, url string) error
+}
+
+// httpHealthChecker passes a check when an HTTP GET of the URL succeeds.
+type httpHealthChecker struct {
+	client *http.Client
+}
+
+func (c httpHealthChecker) Check(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("GET %v: %v", url, resp.Status)
+	}
+	return nil
+}
+
+// progressiveRollout advances the progressive rollout of the PodInfo image and returns the
+// objects it adds to the resource set. observed.podInfo is left running the stable image,
+// and the PodInfo Service or HTTPRoute of observed send traffic to the tracks that serve it.
+func (r *PodInfoRedisApplicationReconciler) progressiveRollout(ctx context.Context, pira *v1.PodInfoRedisApplication, observed *observedState) ([]client.Object, error) {
+	progressive := pira.Spec.Rollout.Progressive
+	if progressive == nil {
+		observed.rollout = nil
+		return nil, nil
+	}
+	rollout := &v1.RolloutStatus{Phase: v1.RolloutPhaseStable}
+	if pira.Status.Rollout != nil {
+		rollout = pira.Status.Rollout.DeepCopy()
+	}
+	observed.rollout = rollout
+
+	stable, err := r.getDeployment(ctx, observed.podInfo)
+	if err != nil {
+		return nil, err
+	}
+	canary, err := r.getDeployment(ctx, pira.PodInfoCanaryDeployment())
+	if err != nil {
+		return nil, err
+	}
+	if rollout.StableImage == "" {
+		// A Deployment created before progressive rollouts were enabled keeps its image.
+		rollout.StableImage = pira.PodInfoImage()
+		if stable != nil {
+			rollout.StableImage = stable.Spec.Template.Spec.Containers[0].Image
+		}
+	}
+
+	image := pira.PodInfoImage()
+	switch {
+	case rollout.Phase == v1.RolloutPhasePromoting:
+		if stable != nil && stable.Spec.Template.Spec.Containers[0].Image == rollout.StableImage && rolloutComplete(stable) {
+			r.Recorder.Eventf(pira, corev1.EventTypeNormal, "Promoted", "Promoted %v", rollout.StableImage)
+			finishRollout(rollout, v1.RolloutResultPromoted, rollout.StableImage, "")
+		}
+	case image == rollout.StableImage:
+		if rollout.Phase == v1.RolloutPhaseProgressing {
+			r.Recorder.Eventf(pira, corev1.EventTypeNormal, "RolledBack", "Removed canary %v, as spec.image was reverted", rollout.CanaryImage)
+			finishRollout(rollout, v1.RolloutResultRolledBack, rollout.CanaryImage, "spec.image was reverted")
+		}
+		rollout.Phase, rollout.CanaryImage = v1.RolloutPhaseStable, ""
+	case rollout.Phase == v1.RolloutPhaseRolledBack && image == rollout.CanaryImage:
+		// Left rolled back until spec.image changes again.
+	case rollout.Phase != v1.RolloutPhaseProgressing || image != rollout.CanaryImage:
+		r.Recorder.Eventf(pira, corev1.EventTypeNormal, "RolloutStarted", "Rolling out %v through a canary", image)
+		rollout.Phase, rollout.CanaryImage, rollout.Step, rollout.StepStartTime = v1.RolloutPhaseProgressing, image, 0, lo.ToPtr(metav1.Now())
+	default:
+		r.advanceRollout(ctx, pira, rollout, canary, observed)
+	}
+	return r.rolloutObjects(pira, rollout, observed), nil
+}
+
+// advanceRollout moves the canary to the next step once it has passed its check for long
+// enough, or rolls it back once it has failed it for too long.
+func (r *PodInfoRedisApplicationReconciler) advanceRollout(ctx context.Context, pira *v1.PodInfoRedisApplication, rollout *v1.RolloutStatus, canary *appsv1.Deployment, observed *observedState) {
+	progressive := pira.Spec.Rollout.Progressive
+	elapsed := time.Since(rollout.StepStartTime.Time)
+	err := r.checkCanary(ctx, pira, rollout, canary)
+	switch {
+	case err == nil && elapsed >= progressive.StepDuration():
+		rollout.Step++
+		rollout.StepStartTime = lo.ToPtr(metav1.Now())
+		weights := progressive.Weights()
+		if int(rollout.Step) < len(weights) {
+			r.Recorder.Eventf(pira, corev1.EventTypeNormal, "RolloutStepped", "Canary %v passed step %v, sending it %v%% of traffic", rollout.CanaryImage, rollout.Step, weights[rollout.Step])
+			observed.requeueWithin(progressive.StepDuration())
+			return
+		}
+		r.Recorder.Eventf(pira, corev1.EventTypeNormal, "Promoting", "Canary %v passed every step, updating the stable Deployment to it", rollout.CanaryImage)
+		rollout.Phase, rollout.StableImage = v1.RolloutPhasePromoting, rollout.CanaryImage
+	case err == nil:
+		observed.requeueWithin(progressive.StepDuration() - elapsed)
+	case elapsed >= progressive.Deadline():
+		image := rollout.CanaryImage
+		r.Recorder.Eventf(pira, corev1.EventTypeWarning, "RolledBack", "Rolled back canary %v, which failed step %v: %v", image, rollout.Step, err)
+		finishRollout(rollout, v1.RolloutResultRolledBack, image, err.Error())
+		// The image is kept, so that it isn't rolled out again.
+		rollout.Phase, rollout.CanaryImage = v1.RolloutPhaseRolledBack, image
+	default:
+		observed.requeueWithin(min(canaryCheckInterval, progressive.Deadline()-elapsed))
+	}
+}
+
+// checkCanary returns why the canary doesn't pass the check of its current step, if it
+// doesn't.
+func (r *PodInfoRedisApplicationReconciler) checkCanary(ctx context.Context, pira *v1.PodInfoRedisApplication, rollout *v1.RolloutStatus, canary *appsv1.Deployment) error {
+	if canary == nil || canary.Spec.Template.Spec.Containers[0].Image != rollout.CanaryImage {
+		return fmt.Errorf("canary is not running %v yet", rollout.CanaryImage)
+	}
+	if replicas := lo.FromPtrOr(canary.Spec.Replicas, 1); !rolloutComplete(canary) || canary.Status.AvailableReplicas < replicas {
+		return fmt.Errorf("%v of %v canary pods are available", canary.Status.AvailableReplicas, replicas)
+	}
+	if pira.Spec.Rollout.Progressive.Check != v1.RolloutCheckHTTP {
+		return nil
+	}
+	service := pira.PodInfoTrackService(v1.TrackCanary)
+	url := fmt.Sprintf("http://%v.%v.svc:%v/healthz", service.Name, service.Namespace, service.Spec.Ports[0].Port)
+	checker := r.HealthChecker
+	if checker == nil {
+		checker = httpHealthChecker{client: &http.Client{Timeout: 5 * time.Second}}
+	}
+	return checker.Check(ctx, url)
+}
+
+// rolloutObjects returns the canary objects of the current phase of rollout, and points the
+// traffic of observed at the tracks that serve it.
+func (r *PodInfoRedisApplicationReconciler) rolloutObjects(pira *v1.PodInfoRedisApplication, rollout *v1.RolloutStatus, observed *observedState) []client.Object {
+	progressive := pira.Spec.Rollout.Progressive
+	observed.podInfo.Spec.Template.Spec.Containers[0].Image = rollout.StableImage
+	switch rollout.Phase {
+	case v1.RolloutPhaseProgressing:
+		// The steps may have been shortened since the canary reached its step.
+		weights := progressive.Weights()
+		rollout.Weight = weights[min(int(rollout.Step), len(weights)-1)]
+	case v1.RolloutPhasePromoting:
+		rollout.Weight = 100
+	default:
+		rollout.Step, rollout.Weight, rollout.StepStartTime = 0, 0, nil
+		return nil
+	}
+
+	total := lo.FromPtrOr(pira.Spec.ReplicaCount, 1)
+	replicas := total
+	canaryShare := progressive.Strategy != v1.ProgressiveStrategyBlueGreen && rollout.Phase == v1.RolloutPhaseProgressing
+	if canaryShare {
+		replicas = max(int32(math.Ceil(float64(total*rollout.Weight)/100)), 1)
+	}
+	canary := pira.PodInfoCanaryDeployment()
+	canary.Spec.Replicas = lo.ToPtr(replicas)
+	// Runs the stable pods on the canary image, with the checksums they restart on.
+	canary.Spec.Template.Spec = *observed.podInfo.Spec.Template.Spec.DeepCopy()
+	canary.Spec.Template.Spec.Containers[0].Image = rollout.CanaryImage
+	canary.Spec.Template.Annotations = lo.Assign(observed.podInfo.Spec.Template.Annotations)
+	observed.podInfoCanary = canary
+	canaryService := pira.PodInfoTrackService(v1.TrackCanary)
+	objs := []client.Object{canary, canaryService}
+
+	switch {
+	case progressive.TrafficRouting == v1.TrafficRoutingGatewayWeight:
+		stableService := pira.PodInfoTrackService(v1.TrackStable)
+		objs = append(objs, stableService)
+		if observed.httpRoute != nil {
+			for i := range observed.httpRoute.Spec.Rules {
+				observed.httpRoute.Spec.Rules[i].BackendRefs = []gatewayv1.HTTPBackendRef{
+					weightedBackend(stableService, 100-rollout.Weight),
+					weightedBackend(canaryService, rollout.Weight),
+				}
+			}
+		}
+	case progressive.Strategy == v1.ProgressiveStrategyBlueGreen:
+		// The PodInfo Service switches from the stable pods to the canary ones once promoted.
+		observed.podInfoService.Spec.Selector[v1.LabelTrack] = lo.Ternary(rollout.Phase == v1.RolloutPhasePromoting, v1.TrackCanary, v1.TrackStable)
+	case canaryShare:
+		// The PodInfo Service selects both tracks, so the canary takes its share of replicas
+		// from the stable Deployment.
+		observed.podInfo.Spec.Replicas = lo.ToPtr(max(total-replicas, 1))
+	}
+	return objs
+}
+
+func weightedBackend(service *corev1.Service, weight int32) gatewayv1.HTTPBackendRef {
+	return gatewayv1.HTTPBackendRef{
+		BackendRef: gatewayv1.BackendRef{
+			BackendObjectReference: gatewayv1.BackendObjectReference{
+				Name: gatewayv1.ObjectName(service.Name),
+				Port: lo.ToPtr(gatewayv1.PortNumber(service.Spec.Ports[0].Port)),
+			},
+			Weight: lo.ToPtr(weight),
+		},
+	}
+}
+
+// finishRollout records the outcome of the rollout of image and returns rollout to the stable
+// phase.
+func finishRollout(rollout *v1.RolloutStatus, result v1.RolloutResult, image, message string) {
+	rollout.History = append(rollout.History, v1.RolloutRecord{Image: image, Result: result, Time: metav1.Now(), Message: message})
+	if len(rollout.History) > maxRolloutHistory {
+		rollout.History = rollout.History[len(rollout.History)-maxRolloutHistory:]
+	}
+	rollout.Phase, rollout.CanaryImage = v1.RolloutPhaseStable, ""
+}
+
+// recreateCheckInterval is how often a Deployment being deleted to be recreated is checked.
+const recreateCheckInterval = 5 * time.Second
+
+// recreatePodInfo deletes the PodInfo Deployment if its selector, which can't be changed in
+// place, isn't the one of desired. Its ReplicaSets are orphaned, and adopted by the Deployment
+// created in its place, whose selector still matches their pods, so that none restart. It
+// reports whether the Deployment is still being deleted.
+func (r *PodInfoRedisApplicationReconciler) recreatePodInfo(ctx context.Context, pira *v1.PodInfoRedisApplication, desired *appsv1.Deployment) (bool, error) {
+	live, err := r.getDeployment(ctx, desired)
+	if err != nil || live == nil {
+		return false, err
+	}
+	if !live.DeletionTimestamp.IsZero() {
+		return true, nil
+	}
+	if equality.Semantic.DeepEqual(live.Spec.Selector, desired.Spec.Selector) || !metav1.IsControlledBy(live, pira) {
+		return false, nil
+	}
+	log.FromContext(ctx).Info("Recreating Deployment to change its selector", "deployment", live.Name)
+	err = r.delete(ctx, pira, live, client.PropagationPolicy(metav1.DeletePropagationOrphan), client.Preconditions{UID: lo.ToPtr(live.UID)})
+	return err == nil, err
+}
+
+// getDeployment returns the live Deployment of d, or nil if there is none.
+func (r *PodInfoRedisApplicationReconciler) getDeployment(ctx context.Context, d *appsv1.Deployment) (*appsv1.Deployment, error) {
+	live := &appsv1.Deployment{}
+	err := r.Client.Get(ctx, client.ObjectKeyFromObject(d), live)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting %v: %v", d.Name, err)
+	}
+	return live, nil
+}
@@ -0,0 +1,399 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	v1 "neeraj.angi/app-operator/api/v1"
+	"neeraj.angi/app-operator/util/kubeclient"
+)
+
+// observedState holds the live objects whose state is reported in the status of a
+// PodInfoRedisApplication. Components that are disabled are left nil.
+type observedState struct {
+	podInfo        *appsv1.Deployment
+	podInfoService *corev1.Service
+	// podInfoCanary runs the image being rolled out progressively, if any.
+	podInfoCanary *appsv1.Deployment
+	ingress       *networkingv1.Ingress
+	httpRoute     *gatewayv1.HTTPRoute
+	redis         *appsv1.Deployment
+	// redisStatefulSet replaces redis while Redis persistence is enabled, or holds the
+	// nodes of the replicated and sentinel modes.
+	redisStatefulSet *appsv1.StatefulSet
+	redisSentinel    *appsv1.StatefulSet
+	// redisPrimary is the node pod found to be the primary.
+	redisPrimary string
+	// redisPending is set while PodInfo is left without the managed Redis, which isn't ready
+	// yet.
+	redisPending bool
+
+	// redisReachable is the outcome of the reachability check of an external Redis, left nil
+	// unless the check is enabled.
+	redisReachable *metav1.Condition
+
+	// rollout is the progress of a progressive rollout, left nil unless one is configured.
+	rollout *v1.RolloutStatus
+	// autoRollback tracks the revisions of PodInfo, left nil unless automatic rollback is
+	// configured.
+	autoRollback *v1.AutoRollbackStatus
+	// inventory lists the objects applied, left nil unless the resource set was applied.
+	inventory []kubeclient.InventoryEntry
+	// applied lists the objects the apply changed, as "<kind> <name>", by its result.
+	applied map[kubeclient.Result][]string
+	// requeueAfter schedules another reconcile, such as to renew a certificate.
+	requeueAfter time.Duration
+}
+
+// requeueWithin schedules another reconcile no later than after d.
+func (o *observedState) requeueWithin(d time.Duration) {
+	if o.requeueAfter == 0 || d < o.requeueAfter {
+		o.requeueAfter = d
+	}
+}
+
+// updateStatus records the observed state of the owned Deployments, along with the
+// outcome of the reconcile, on pira's status subresource.
+func (r *PodInfoRedisApplicationReconciler) updateStatus(ctx context.Context, pira *v1.PodInfoRedisApplication, observed *observedState, reconcileErr error) error {
+	before := pira.Status.DeepCopy()
+	status := &pira.Status
+	status.ObservedGeneration = pira.Generation
+
+	status.PodInfo = componentStatus(observed.podInfo)
+	status.URL = r.podInfoURL(ctx, observed)
+	status.RedisPrimary = observed.redisPrimary
+	status.Rollout = observed.rollout
+	status.AutoRollback = observed.autoRollback
+	if observed.inventory != nil {
+		status.Inventory = lo.Map(observed.inventory, func(entry kubeclient.InventoryEntry, _ int) v1.InventoryEntry {
+			return v1.InventoryEntry(entry)
+		})
+	}
+	setCondition(pira, availableCondition(v1.ConditionPodInfoAvailable, observed.podInfo))
+	ready := meta.IsStatusConditionTrue(status.Conditions, v1.ConditionPodInfoAvailable)
+	switch {
+	case observed.redis != nil:
+		status.Redis = lo.ToPtr(componentStatus(observed.redis))
+		setCondition(pira, availableCondition(v1.ConditionRedisAvailable, observed.redis))
+		ready = ready && meta.IsStatusConditionTrue(status.Conditions, v1.ConditionRedisAvailable)
+	case observed.redisStatefulSet != nil:
+		status.Redis = lo.ToPtr(statefulSetComponentStatus(observed.redisStatefulSet))
+		available := statefulSetAvailableCondition(v1.ConditionRedisAvailable, observed.redisStatefulSet)
+		// Without its Sentinels, Redis in the sentinel mode can't fail over, nor PodInfo find
+		// the primary.
+		if observed.redisSentinel != nil && available.Status == metav1.ConditionTrue {
+			if sentinels := statefulSetAvailableCondition(v1.ConditionRedisAvailable, observed.redisSentinel); sentinels.Status != metav1.ConditionTrue {
+				available = sentinels
+			}
+		}
+		setCondition(pira, available)
+		ready = ready && meta.IsStatusConditionTrue(status.Conditions, v1.ConditionRedisAvailable)
+	default:
+		status.Redis = nil
+		meta.RemoveStatusCondition(&status.Conditions, v1.ConditionRedisAvailable)
+	}
+
+	setCondition(pira, cacheCondition(pira, observed))
+	if observed.autoRollback != nil {
+		setCondition(pira, rolledBackCondition(observed.autoRollback))
+	} else {
+		meta.RemoveStatusCondition(&status.Conditions, v1.ConditionRolledBack)
+	}
+	switch {
+	case pira.Paused():
+		setCondition(pira, pausedCondition(pira))
+	case reconcileErr == nil:
+		// Kept until the objects are applied again, so that a failed resume is retried.
+		meta.RemoveStatusCondition(&status.Conditions, v1.ConditionPaused)
+	}
+	if observed.redisReachable != nil {
+		setCondition(pira, *observed.redisReachable)
+		ready = ready && observed.redisReachable.Status == metav1.ConditionTrue
+	} else {
+		meta.RemoveStatusCondition(&status.Conditions, v1.ConditionRedisReachable)
+	}
+
+	deployments := lo.Compact([]*appsv1.Deployment{observed.podInfo, observed.podInfoCanary, observed.redis})
+	var rollingOut []string
+	for _, d := range deployments {
+		if !rolloutComplete(d) {
+			rollingOut = append(rollingOut, d.Name)
+		}
+	}
+	for _, sts := range lo.Compact([]*appsv1.StatefulSet{observed.redisStatefulSet, observed.redisSentinel}) {
+		if !statefulSetRolloutComplete(sts) {
+			rollingOut = append(rollingOut, sts.Name)
+		}
+	}
+	stalled, isStalled := lo.Find(deployments, func(d *appsv1.Deployment) bool {
+		c := deploymentCondition(d, appsv1.DeploymentProgressing)
+		return c != nil && c.Status == corev1.ConditionFalse && d.Status.ObservedGeneration >= d.Generation
+	})
+	switch {
+	case isStalled:
+		// The Deployment controller gave up on a rollout that passed its progress deadline.
+		c := deploymentCondition(stalled, appsv1.DeploymentProgressing)
+		setCondition(pira, metav1.Condition{
+			Type:    v1.ConditionProgressing,
+			Status:  metav1.ConditionFalse,
+			Reason:  c.Reason,
+			Message: fmt.Sprintf("%v: %v", stalled.Name, c.Message),
+		})
+	case len(rollingOut) > 0:
+		setCondition(pira, metav1.Condition{
+			Type:    v1.ConditionProgressing,
+			Status:  metav1.ConditionTrue,
+			Reason:  "RollingOut",
+			Message: fmt.Sprintf("Waiting for rollout of %v", strings.Join(rollingOut, ", ")),
+		})
+	default:
+		setCondition(pira, metav1.Condition{
+			Type:   v1.ConditionProgressing,
+			Status: metav1.ConditionFalse,
+			Reason: "RolloutComplete",
+		})
+	}
+
+	degraded := metav1.Condition{Type: v1.ConditionDegraded, Status: metav1.ConditionFalse, Reason: "AsExpected"}
+	if reconcileErr != nil {
+		degraded.Status, degraded.Reason, degraded.Message = metav1.ConditionTrue, "ReconcileFailed", reconcileErr.Error()
+	} else {
+		for _, d := range deployments {
+			if c := deploymentCondition(d, appsv1.DeploymentReplicaFailure); c != nil && c.Status == corev1.ConditionTrue {
+				degraded.Status, degraded.Reason, degraded.Message = metav1.ConditionTrue, c.Reason, fmt.Sprintf("%v: %v", d.Name, c.Message)
+				break
+			}
+		}
+	}
+	setCondition(pira, degraded)
+	ready = ready && degraded.Status == metav1.ConditionFalse
+
+	if ready {
+		setCondition(pira, metav1.Condition{
+			Type:   v1.ConditionReady,
+			Status: metav1.ConditionTrue,
+			Reason: "ComponentsAvailable",
+		})
+	} else {
+		setCondition(pira, metav1.Condition{
+			Type:    v1.ConditionReady,
+			Status:  metav1.ConditionFalse,
+			Reason:  "ComponentsUnavailable",
+			Message: "One or more components are unavailable or degraded",
+		})
+	}
+
+	recordApplication(pira)
+	if equality.Semantic.DeepEqual(before, status) {
+		return nil
+	}
+	return r.Client.Status().Update(ctx, pira)
+}
+
+// podInfoURL returns the URL PodInfo is served on, preferring the Ingress or HTTPRoute host
+// over the Service address. Services that aren't load balanced report their in-cluster address.
+func (r *PodInfoRedisApplicationReconciler) podInfoURL(ctx context.Context, observed *observedState) string {
+	switch {
+	case observed.ingress != nil:
+		rule := observed.ingress.Spec.Rules[0]
+		scheme := lo.Ternary(len(observed.ingress.Spec.TLS) > 0, "https", "http")
+		return fmt.Sprintf("%v://%v%v", scheme, rule.Host, rule.HTTP.Paths[0].Path)
+	case observed.httpRoute != nil:
+		route := observed.httpRoute
+		scheme := lo.Ternary(r.terminatesTLS(ctx, route), "https", "http")
+		return fmt.Sprintf("%v://%v%v", scheme, route.Spec.Hostnames[0], lo.FromPtr(route.Spec.Rules[0].Matches[0].Path.Value))
+	}
+
+	svc := observed.podInfoService
+	if svc == nil {
+		return ""
+	}
+	port := svc.Spec.Ports[0].Port
+	if svc.Spec.Type == corev1.ServiceTypeLoadBalancer && len(svc.Status.LoadBalancer.Ingress) > 0 {
+		lb := svc.Status.LoadBalancer.Ingress[0]
+		return fmt.Sprintf("http://%v:%v", lo.Ternary(lb.Hostname != "", lb.Hostname, lb.IP), port)
+	}
+	return fmt.Sprintf("http://%v.%v.svc:%v", svc.Name, svc.Namespace, port)
+}
+
+// terminatesTLS reports whether a Gateway route attaches to has an HTTPS listener for it.
+// Gateways that can't be read are treated as serving plain HTTP.
+func (r *PodInfoRedisApplicationReconciler) terminatesTLS(ctx context.Context, route *gatewayv1.HTTPRoute) bool {
+	for _, ref := range route.Spec.ParentRefs {
+		if lo.FromPtrOr(ref.Kind, "Gateway") != "Gateway" {
+			continue
+		}
+		var gateway gatewayv1.Gateway
+		key := client.ObjectKey{Namespace: string(lo.FromPtrOr(ref.Namespace, gatewayv1.Namespace(route.Namespace))), Name: string(ref.Name)}
+		if err := r.Client.Get(ctx, key, &gateway); err != nil {
+			continue
+		}
+		for _, listener := range gateway.Spec.Listeners {
+			if ref.SectionName != nil && *ref.SectionName != listener.Name {
+				continue
+			}
+			if listener.Protocol == gatewayv1.HTTPSProtocolType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setCondition sets c on pira, stamping it with the generation it was observed at.
+func setCondition(pira *v1.PodInfoRedisApplication, c metav1.Condition) {
+	c.ObservedGeneration = pira.Generation
+	meta.SetStatusCondition(&pira.Status.Conditions, c)
+}
+
+func componentStatus(d *appsv1.Deployment) v1.ComponentStatus {
+	return v1.ComponentStatus{
+		Replicas:      lo.FromPtr(d.Spec.Replicas),
+		ReadyReplicas: d.Status.ReadyReplicas,
+	}
+}
+
+// cacheCondition reports which Redis, if any, PodInfo is configured to cache in.
+func cacheCondition(pira *v1.PodInfoRedisApplication, observed *observedState) metav1.Condition {
+	c := metav1.Condition{Type: v1.ConditionCacheEnabled, Status: metav1.ConditionTrue}
+	switch {
+	case observed.redisPending:
+		c.Status, c.Reason = metav1.ConditionFalse, "WaitingForRedis"
+		c.Message = fmt.Sprintf("PodInfo caches in Redis %v once it is ready", pira.RedisService().Name)
+	case pira.Spec.Redis.Enabled:
+		c.Reason, c.Message = "ManagedRedis", fmt.Sprintf("PodInfo caches in Redis %v", pira.RedisService().Name)
+	case pira.Spec.Redis.External != nil:
+		c.Reason, c.Message = "ExternalRedis", fmt.Sprintf("PodInfo caches in the external Redis at %v", pira.Spec.Redis.External.Address)
+	default:
+		c.Status, c.Reason = metav1.ConditionFalse, "RedisDisabled"
+		c.Message = "PodInfo runs without a cache, as Redis is neither enabled nor external"
+	}
+	return c
+}
+
+// pausedCondition reports what paused pira.
+func pausedCondition(pira *v1.PodInfoRedisApplication) metav1.Condition {
+	if pira.Spec.Paused {
+		return metav1.Condition{Type: v1.ConditionPaused, Status: metav1.ConditionTrue, Reason: "SpecPaused", Message: "spec.paused is set"}
+	}
+	return metav1.Condition{
+		Type:    v1.ConditionPaused,
+		Status:  metav1.ConditionTrue,
+		Reason:  "AnnotationPaused",
+		Message: fmt.Sprintf("The %v annotation is set", v1.AnnotationPaused),
+	}
+}
+
+// availableCondition mirrors the Available condition of d onto a condition of type t.
+func availableCondition(t string, d *appsv1.Deployment) metav1.Condition {
+	c := deploymentCondition(d, appsv1.DeploymentAvailable)
+	if c == nil {
+		return metav1.Condition{
+			Type:    t,
+			Status:  metav1.ConditionUnknown,
+			Reason:  "AwaitingStatus",
+			Message: fmt.Sprintf("Deployment %v has not reported availability yet", d.Name),
+		}
+	}
+	return metav1.Condition{
+		Type:    t,
+		Status:  metav1.ConditionStatus(c.Status),
+		Reason:  c.Reason,
+		Message: c.Message,
+	}
+}
+
+func deploymentCondition(d *appsv1.Deployment, t appsv1.DeploymentConditionType) *appsv1.DeploymentCondition {
+	for i := range d.Status.Conditions {
+		if d.Status.Conditions[i].Type == t {
+			return &d.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+func statefulSetComponentStatus(sts *appsv1.StatefulSet) v1.ComponentStatus {
+	return v1.ComponentStatus{
+		Replicas:      lo.FromPtr(sts.Spec.Replicas),
+		ReadyReplicas: sts.Status.ReadyReplicas,
+	}
+}
+
+// statefulSetAvailableCondition reports a condition of type t that is True once every replica
+// of sts is available, as StatefulSets have no Available condition of their own.
+func statefulSetAvailableCondition(t string, sts *appsv1.StatefulSet) metav1.Condition {
+	if sts.Status.ObservedGeneration == 0 {
+		return metav1.Condition{
+			Type:    t,
+			Status:  metav1.ConditionUnknown,
+			Reason:  "AwaitingStatus",
+			Message: fmt.Sprintf("StatefulSet %v has not reported availability yet", sts.Name),
+		}
+	}
+	if replicas := lo.FromPtrOr(sts.Spec.Replicas, 1); sts.Status.AvailableReplicas < replicas {
+		return metav1.Condition{
+			Type:    t,
+			Status:  metav1.ConditionFalse,
+			Reason:  "MinimumReplicasUnavailable",
+			Message: fmt.Sprintf("StatefulSet %v has %v of %v replicas available", sts.Name, sts.Status.AvailableReplicas, replicas),
+		}
+	}
+	return metav1.Condition{
+		Type:    t,
+		Status:  metav1.ConditionTrue,
+		Reason:  "MinimumReplicasAvailable",
+		Message: fmt.Sprintf("StatefulSet %v has all replicas available", sts.Name),
+	}
+}
+
+// statefulSetRolloutComplete follows the same checks as `kubectl rollout status` for the
+// RollingUpdate strategy.
+func statefulSetRolloutComplete(sts *appsv1.StatefulSet) bool {
+	if sts.Generation > sts.Status.ObservedGeneration {
+		return false
+	}
+	replicas := lo.FromPtrOr(sts.Spec.Replicas, 1)
+	if sts.Status.ReadyReplicas < replicas || sts.Status.UpdatedReplicas < replicas {
+		return false
+	}
+	return sts.Status.UpdateRevision == sts.Status.CurrentRevision
+}
+
+// rolloutComplete follows the same checks as `kubectl rollout status`.
+func rolloutComplete(d *appsv1.Deployment) bool {
+	if d.Generation > d.Status.ObservedGeneration {
+		return false
+	}
+	if d.Spec.Replicas != nil && d.Status.UpdatedReplicas < *d.Spec.Replicas {
+		return false
+	}
+	return d.Status.Replicas <= d.Status.UpdatedReplicas && d.Status.AvailableReplicas >= d.Status.UpdatedReplicas
+}
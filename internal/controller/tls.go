@@ -0,0 +1,159 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Lifetimes of the certificates the operator issues. Both are renewed once two thirds of
+// their lifetime has passed.
+const (
+	caValidity   = 5 * 365 * 24 * time.Hour
+	certValidity = 365 * 24 * time.Hour
+)
+
+// keyPair is a PEM encoded certificate and private key.
+type keyPair struct {
+	cert []byte
+	key  []byte
+}
+
+// newCA generates a self-signed CA certificate.
+func newCA(commonName string, now time.Time) (keyPair, error) {
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: commonName},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	return issue(template, nil, nil, now, caValidity)
+}
+
+// issueCert issues a server certificate for dnsNames from ca.
+func issueCert(ca keyPair, dnsNames []string, now time.Time) (keyPair, error) {
+	caCert, err := parseCert(ca.cert)
+	if err != nil {
+		return keyPair{}, fmt.Errorf("parsing CA certificate: %v", err)
+	}
+	caKey, err := parseKey(ca.key)
+	if err != nil {
+		return keyPair{}, fmt.Errorf("parsing CA key: %v", err)
+	}
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:    dnsNames,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	return issue(template, caCert, caKey, now, certValidity)
+}
+
+// issue signs template with parent and parentKey, or self-signs it if parent is nil.
+func issue(template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, now time.Time, validity time.Duration) (keyPair, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return keyPair{}, fmt.Errorf("generating key: %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return keyPair{}, fmt.Errorf("generating serial number: %v", err)
+	}
+	template.SerialNumber = serial
+	// Backdated to tolerate clock skew between the operator and clients.
+	template.NotBefore = now.Add(-time.Hour)
+	template.NotAfter = now.Add(validity)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return keyPair{}, fmt.Errorf("creating certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return keyPair{}, fmt.Errorf("encoding key: %v", err)
+	}
+	return keyPair{
+		cert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		key:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}, nil
+}
+
+// validCert returns the time at which the certificate in pair should be renewed, or an error
+// if it can't be used: it doesn't parse, doesn't match its key, isn't issued by ca, or isn't
+// valid for dnsNames.
+// A nil ca means pair must be self-signed.
+func validCert(pair keyPair, ca []byte, dnsNames []string) (time.Time, error) {
+	cert, err := parseCert(pair.cert)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if _, err := parseKey(pair.key); err != nil {
+		return time.Time{}, err
+	}
+	if _, err := tls.X509KeyPair(pair.cert, pair.key); err != nil {
+		return time.Time{}, err
+	}
+	roots := x509.NewCertPool()
+	if ca == nil {
+		ca = pair.cert
+	}
+	if !roots.AppendCertsFromPEM(ca) {
+		return time.Time{}, errors.New("no CA certificate")
+	}
+	opts := x509.VerifyOptions{Roots: roots, CurrentTime: cert.NotBefore, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}
+	for _, name := range dnsNames {
+		opts.DNSName = name
+		if _, err := cert.Verify(opts); err != nil {
+			return time.Time{}, err
+		}
+	}
+	if len(dnsNames) == 0 {
+		if _, err := cert.Verify(opts); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return cert.NotBefore.Add(cert.NotAfter.Sub(cert.NotBefore) * 2 / 3), nil
+}
+
+func parseCert(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM encoded certificate")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func parseKey(data []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "EC PRIVATE KEY" {
+		return nil, errors.New("no PEM encoded EC private key")
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
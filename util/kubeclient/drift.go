@@ -0,0 +1,74 @@
+package kubeclient
+
+import (
+	"fmt"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// HasDrifted reports whether any field set on desired has a different value on live. Fields
+// desired leaves unset or zero are ignored, matching the hash, since the API server and other
+// controllers default or own them; lists must match in length so removed entries are caught.
+func HasDrifted(desired, live client.Object) (bool, error) {
+	d, err := runtime.DefaultUnstructuredConverter.ToUnstructured(desired)
+	if err != nil {
+		return false, fmt.Errorf("converting desired object: %v", err)
+	}
+	l, err := runtime.DefaultUnstructuredConverter.ToUnstructured(live)
+	if err != nil {
+		return false, fmt.Errorf("converting live object: %v", err)
+	}
+
+	// Only labels and annotations are managed in metadata; the rest is server-populated.
+	for _, key := range []string{"apiVersion", "kind", "metadata", "status"} {
+		delete(d, key)
+		delete(l, key)
+	}
+	if !derived(desired.GetLabels(), live.GetLabels()) || !derived(desired.GetAnnotations(), live.GetAnnotations()) {
+		return true, nil
+	}
+	return !derived(d, l), nil
+}
+
+// derived reports whether live carries every value set in desired.
+func derived(desired, live interface{}) bool {
+	switch d := desired.(type) {
+	case nil:
+		return true
+	case map[string]string:
+		l, _ := live.(map[string]string)
+		for k, v := range d {
+			if lv, ok := l[k]; !ok || lv != v {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		l, _ := live.(map[string]interface{})
+		for k, v := range d {
+			if !derived(v, l[k]) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		l, _ := live.([]interface{})
+		if len(d) != len(l) {
+			return false
+		}
+		for i := range d {
+			if !derived(d[i], l[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		if reflect.ValueOf(desired).IsZero() {
+			return true
+		}
+		return equality.Semantic.DeepEqual(desired, live)
+	}
+}
@@ -0,0 +1,63 @@
+package kubeclient
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("HasDrifted", func() {
+	var desired, live *appsv1.Deployment
+
+	BeforeEach(func() {
+		desired = &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app", Labels: map[string]string{"app": "podinfo"}},
+			Spec: appsv1.DeploymentSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "podinfo"}},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "podinfo"}},
+					Spec: corev1.PodSpec{Containers: []corev1.Container{{
+						Name:  "podinfo",
+						Image: "podinfo:6.5.4",
+						Env:   []corev1.EnvVar{{Name: "PODINFO_UI_COLOR", Value: "#34577c"}},
+					}}},
+				},
+			},
+		}
+		// As stored, with the fields the API server and other controllers fill in.
+		live = desired.DeepCopy()
+		live.UID, live.ResourceVersion = "uid", "1"
+		live.Labels["team"] = "web"
+		live.Annotations = map[string]string{"deployment.kubernetes.io/revision": "1"}
+		live.Spec.Replicas = lo.ToPtr(int32(3))
+		live.Spec.Template.Spec.Containers[0].ImagePullPolicy = corev1.PullIfNotPresent
+		live.Spec.Template.Spec.RestartPolicy = corev1.RestartPolicyAlways
+		live.Status.ReadyReplicas = 3
+	})
+
+	It("should ignore fields that desired leaves unset", func() {
+		Expect(HasDrifted(desired, live)).To(BeFalse())
+	})
+
+	It("should catch a field set to another value", func() {
+		live.Spec.Template.Spec.Containers[0].Image = "podinfo:latest"
+		Expect(HasDrifted(desired, live)).To(BeTrue())
+	})
+
+	It("should catch a label set to another value", func() {
+		live.Labels["app"] = "other"
+		Expect(HasDrifted(desired, live)).To(BeTrue())
+	})
+
+	It("should catch an added or removed list entry", func() {
+		added := live.DeepCopy()
+		added.Spec.Template.Spec.Containers[0].Env = append(added.Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: "DEBUG", Value: "1"})
+		Expect(HasDrifted(desired, added)).To(BeTrue())
+
+		live.Spec.Template.Spec.Containers[0].Env = nil
+		Expect(HasDrifted(desired, live)).To(BeTrue())
+	})
+})
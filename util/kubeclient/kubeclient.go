@@ -2,46 +2,258 @@ package kubeclient
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"reflect"
 
 	hashstructure "github.com/mitchellh/hashstructure/v2"
 	"github.com/samber/lo"
-	"k8s.io/apimachinery/pkg/api/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/csaupgrade"
 	v1 "neeraj.angi/app-operator/api/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 )
 
+// FieldManager is the field manager recorded in managedFields for every write made by Apply.
+const FieldManager = "app-operator"
+
 var (
 	AnnotationHash = fmt.Sprintf("%v/hash", v1.GroupVersion.Group)
 )
 
-func Apply(ctx context.Context, c client.Client, desired client.Object) error {
+// Result describes the write, if any, that Apply made.
+type Result string
+
+const (
+	ResultCreated   Result = "created"
+	ResultUpdated   Result = "updated"
+	ResultUnchanged Result = "unchanged"
+	// ResultDriftCorrected means the desired state had not changed since the last apply, but
+	// the live object had been modified outside the operator and was restored.
+	ResultDriftCorrected Result = "driftCorrected"
+)
+
+// Options configures how Apply writes objects. The zero value uses the hash-and-update path.
+type Options struct {
+	// ServerSide writes objects with server-side apply, leaving fields set by other
+	// managers (e.g. HPA-managed replicas or injected sidecars) in place.
+	ServerSide bool
+	// ForceConflicts takes ownership of fields owned by another manager instead of
+	// failing with a conflict. Only used with ServerSide. Fields modified outside the operator
+	// since its last apply are taken back regardless, to correct the drift.
+	ForceConflicts bool
+}
+
+// Apply creates or updates desired according to opts and reports the write it made. On
+// success desired holds the object as stored in the cluster, so callers can read its status
+// without another Get. Each apply is traced in a span, with child spans for its steps.
+func Apply(ctx context.Context, c client.Client, desired client.Object, opts Options) (result Result, err error) {
+	ctx, span := StartSpan(ctx, c, "Apply", desired)
+	defer func() { EndSpan(span, string(result), err) }()
+
 	existing := desired.DeepCopyObject().(client.Object)
 	objKey := client.ObjectKeyFromObject(desired)
-	err := c.Get(ctx, objKey, existing)
-	if client.IgnoreNotFound(err) != nil {
-		return fmt.Errorf("failed to get %v: %v", objKey, err)
+	var getErr error
+	if err := traced(ctx, "Get", func(ctx context.Context) error {
+		getErr = c.Get(ctx, objKey, existing)
+		return client.IgnoreNotFound(getErr)
+	}); err != nil {
+		return "", fmt.Errorf("failed to get %v: %v", objKey, err)
+	}
+	found := getErr == nil
+
+	var desiredHash string
+	if err := traced(ctx, "Hash", func(context.Context) (err error) {
+		desiredHash, err = hash(desired)
+		return err
+	}); err != nil {
+		return "", err
+	}
+	span.SetAttributes(AttributeHash.String(desiredHash))
+	hashMatches := found && existing.GetAnnotations()[AnnotationHash] == desiredHash
+
+	if opts.ServerSide {
+		var drifted bool
+		if found {
+			if err := upgradeManagedFields(ctx, c, existing); err != nil {
+				return "", err
+			}
+			if err := preserveUntilHandedOver(desired, existing); err != nil {
+				return "", err
+			}
+			if hashMatches {
+				if err := traced(ctx, "Diff", func(context.Context) (err error) {
+					drifted, err = HasDrifted(desired, existing)
+					return err
+				}); err != nil {
+					return "", err
+				}
+			}
+		}
+		desired.SetAnnotations(lo.Assign(desired.GetAnnotations(), map[string]string{AnnotationHash: desiredHash}))
+		// A field modified outside the operator, such as by kubectl edit, belongs to whoever
+		// modified it, so restoring it takes ownership back.
+		if err := applyServerSide(ctx, c, desired, opts.ForceConflicts || drifted); err != nil {
+			return "", err
+		}
+		switch {
+		case !found:
+			return ResultCreated, nil
+		case desired.GetResourceVersion() == existing.GetResourceVersion():
+			return ResultUnchanged, nil
+		case hashMatches:
+			return ResultDriftCorrected, nil
+		}
+		return ResultUpdated, nil
 	}
 
-	if errors.IsNotFound(err) {
-		return c.Create(ctx, desired)
+	if !found {
+		// Recording the hash on create lets the next apply detect drift without an Update first.
+		desired.SetAnnotations(lo.Assign(desired.GetAnnotations(), map[string]string{AnnotationHash: desiredHash}))
+		if err := traced(ctx, "Create", func(ctx context.Context) error {
+			return c.Create(ctx, desired, client.FieldOwner(FieldManager))
+		}); err != nil {
+			return "", err
+		}
+		return ResultCreated, nil
 	}
+	result = ResultUpdated
+	if hashMatches {
+		var drifted bool
+		if err := traced(ctx, "Diff", func(context.Context) (err error) {
+			drifted, err = HasDrifted(desired, existing)
+			return err
+		}); err != nil {
+			return "", err
+		}
+		if !drifted {
+			reflect.ValueOf(desired).Elem().Set(reflect.ValueOf(existing).Elem())
+			return ResultUnchanged, nil
+		}
+		result = ResultDriftCorrected
+	}
+	desired.SetAnnotations(lo.Assign[string, string](
+		existing.GetAnnotations(),
+		map[string]string{AnnotationHash: desiredHash},
+	))
+	preserveUnset(desired, existing)
+	if err := traced(ctx, "Update", func(ctx context.Context) error {
+		return c.Update(ctx, desired, client.FieldOwner(FieldManager))
+	}); err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// preserveUnset copies fields that desired leaves to other controllers from existing, since an
+// Update would otherwise reset them to their defaults.
+func preserveUnset(desired, existing client.Object) {
+	switch desired := desired.(type) {
+	case *appsv1.Deployment:
+		// Replicas are left unset while a HorizontalPodAutoscaler scales the Deployment.
+		if desired.Spec.Replicas == nil {
+			desired.Spec.Replicas = existing.(*appsv1.Deployment).Spec.Replicas
+		}
+	}
+}
+
+// preserveUntilHandedOver is the server-side apply counterpart of preserveUnset. A field left
+// out of an apply patch keeps its value only while another manager owns it too; one that
+// FieldManager alone owns is removed and reset to its default. Such a field, like the replicas
+// of a Deployment that has just been given a HorizontalPodAutoscaler, is applied with its
+// current value until another manager has taken it over.
+func preserveUntilHandedOver(desired, existing client.Object) error {
+	switch desired := desired.(type) {
+	case *appsv1.Deployment:
+		if desired.Spec.Replicas != nil {
+			return nil
+		}
+		managed, err := managedByOthers(existing, "f:spec", "f:replicas")
+		if err != nil || managed {
+			return err
+		}
+		desired.Spec.Replicas = existing.(*appsv1.Deployment).Spec.Replicas
+	}
+	return nil
+}
 
-	desiredHash, err := hashstructure.Hash(desired, hashstructure.FormatV2, &hashstructure.HashOptions{
+// managedByOthers reports whether a manager other than FieldManager owns the field of obj at
+// path, given in the managedFields format such as "f:spec", "f:replicas".
+func managedByOthers(obj client.Object, path ...string) (bool, error) {
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Manager == FieldManager || entry.FieldsV1 == nil {
+			continue
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			return false, fmt.Errorf("decoding managed fields of %v: %v", entry.Manager, err)
+		}
+		for i, key := range path {
+			field, ok := fields[key]
+			if !ok {
+				break
+			}
+			if i == len(path)-1 {
+				return true, nil
+			}
+			if fields, ok = field.(map[string]interface{}); !ok {
+				break
+			}
+		}
+	}
+	return false, nil
+}
+
+// upgradeManagedFields moves the fields FieldManager owns through updates, made before
+// server-side apply was enabled, over to its apply operation. Without this, applies would
+// conflict with the fields it wrote itself.
+func upgradeManagedFields(ctx context.Context, c client.Client, existing client.Object) error {
+	patch, err := csaupgrade.UpgradeManagedFieldsPatch(existing, sets.New(FieldManager), FieldManager)
+	if err != nil {
+		return fmt.Errorf("upgrading managed fields: %v", err)
+	}
+	if patch == nil {
+		return nil
+	}
+	if err := traced(ctx, "Patch", func(ctx context.Context) error {
+		return c.Patch(ctx, existing, client.RawPatch(types.JSONPatchType, patch))
+	}); err != nil {
+		return fmt.Errorf("upgrading managed fields: %v", err)
+	}
+	return nil
+}
+
+// applyServerSide sends desired as a server-side apply patch owned by FieldManager.
+func applyServerSide(ctx context.Context, c client.Client, desired client.Object, force bool) error {
+	gvk, err := apiutil.GVKForObject(desired, c.Scheme())
+	if err != nil {
+		return fmt.Errorf("looking up kind: %v", err)
+	}
+	// Apply patches are sent as-is, so they must name their own kind.
+	desired.GetObjectKind().SetGroupVersionKind(gvk)
+	desired.SetManagedFields(nil)
+	desired.SetResourceVersion("")
+
+	patchOpts := []client.PatchOption{client.FieldOwner(FieldManager)}
+	if force {
+		patchOpts = append(patchOpts, client.ForceOwnership)
+	}
+	return traced(ctx, "Patch", func(ctx context.Context) error {
+		return c.Patch(ctx, desired, client.Apply, patchOpts...)
+	})
+}
+
+func hash(obj client.Object) (string, error) {
+	h, err := hashstructure.Hash(obj, hashstructure.FormatV2, &hashstructure.HashOptions{
 		SlicesAsSets:    true,
 		IgnoreZeroValue: true,
 		ZeroNil:         true,
 	})
 	if err != nil {
-		return fmt.Errorf("calculating hash: %v", err)
+		return "", fmt.Errorf("calculating hash: %v", err)
 	}
-
-	if existingHash, found := existing.GetAnnotations()[AnnotationHash]; !found || existingHash != fmt.Sprint(desiredHash) {
-		desired.SetAnnotations(lo.Assign[string, string](
-			existing.GetAnnotations(),
-			map[string]string{AnnotationHash: fmt.Sprint(desiredHash)},
-		))
-		return c.Update(ctx, desired)
-	}
-	return nil
+	return fmt.Sprint(h), nil
 }
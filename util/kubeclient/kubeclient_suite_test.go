@@ -0,0 +1,44 @@
+package kubeclient
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// Most of these tests run against the controller-runtime fake client, as the package only
+// needs the API server to store objects, not to run controllers. Server-side apply, which the
+// fake client doesn't support, is tested against the API server envtest starts.
+
+var apiClient client.Client
+var testEnv *envtest.Environment
+
+func TestKubeclient(t *testing.T) {
+	RegisterFailHandler(Fail)
+
+	RunSpecs(t, "Kubeclient Suite")
+}
+
+var _ = BeforeSuite(func() {
+	testEnv = &envtest.Environment{
+		BinaryAssetsDirectory: filepath.Join("..", "..", "bin", "k8s",
+			fmt.Sprintf("1.29.0-%s-%s", runtime.GOOS, runtime.GOARCH)),
+	}
+	cfg, err := testEnv.Start()
+	Expect(err).NotTo(HaveOccurred())
+
+	apiClient, err = client.New(cfg, client.Options{Scheme: scheme.Scheme})
+	Expect(err).NotTo(HaveOccurred())
+})
+
+var _ = AfterSuite(func() {
+	Expect(testEnv.Stop()).To(Succeed())
+})
@@ -0,0 +1,43 @@
+package kubeclient
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Apply", func() {
+	ctx := context.Background()
+
+	// desired returns the ConfigMap the tests apply, anew each time as Apply writes to it.
+	desired := func() *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "server-side"},
+			Data:       map[string]string{"key": "desired"},
+		}
+	}
+
+	AfterEach(func() {
+		Expect(client.IgnoreNotFound(apiClient.Delete(ctx, desired()))).To(Succeed())
+	})
+
+	It("should restore a field edited under another field manager with server-side apply", func() {
+		opts := Options{ServerSide: true}
+		Expect(Apply(ctx, apiClient, desired(), opts)).To(Equal(ResultCreated))
+
+		By("editing the field as kubectl edit would, which takes it over")
+		live := desired()
+		Expect(apiClient.Get(ctx, client.ObjectKeyFromObject(live), live)).To(Succeed())
+		live.Data["key"] = "edited"
+		Expect(apiClient.Update(ctx, live, client.FieldOwner("kubectl-edit"))).To(Succeed())
+
+		Expect(Apply(ctx, apiClient, desired(), opts)).To(Equal(ResultDriftCorrected))
+		Expect(apiClient.Get(ctx, client.ObjectKeyFromObject(live), live)).To(Succeed())
+		Expect(live.Data).To(HaveKeyWithValue("key", "desired"))
+		Expect(Apply(ctx, apiClient, desired(), opts)).To(Equal(ResultUnchanged))
+	})
+})
@@ -0,0 +1,117 @@
+package kubeclient
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/samber/lo"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// ResultPruned means the object had left the resource set and was deleted.
+const ResultPruned Result = "pruned"
+
+// InventoryEntry identifies an object of a resource set, in the namespace of its owner.
+type InventoryEntry struct {
+	Group   string
+	Version string
+	Kind    string
+	Name    string
+}
+
+// ObserveFunc is told of each object ApplySet applies or prunes, with the error if that
+// failed. The result of a failed apply is empty.
+type ObserveFunc func(obj client.Object, result Result, err error)
+
+// ApplySet applies desired, in order, and then prunes the objects of inventory, the set
+// applied last time, that desired no longer holds. Only objects owner controls are pruned,
+// so a user's object that happens to have the same name is left alone. Pruning comes last,
+// so that objects still in the set can stop depending on those that left it first.
+//
+// It returns the inventory to pass to the next ApplySet. When an apply fails, it returns the
+// previous inventory together with what was applied, so that nothing is forgotten.
+func ApplySet(ctx context.Context, c client.Client, owner client.Object, desired []client.Object, inventory []InventoryEntry, opts Options, observe ObserveFunc) ([]InventoryEntry, error) {
+	if observe == nil {
+		observe = func(client.Object, Result, error) {}
+	}
+	applied := make([]InventoryEntry, 0, len(desired))
+	for _, obj := range desired {
+		entry, err := InventoryEntryFor(c, obj)
+		if err != nil {
+			return inventory, err
+		}
+		result, err := Apply(ctx, c, obj, opts)
+		observe(obj, result, err)
+		if err != nil {
+			return lo.Uniq(append(inventory, applied...)), fmt.Errorf("applying %v %v: %v", entry.Kind, entry.Name, err)
+		}
+		applied = append(applied, entry)
+	}
+
+	left, err := Prune(ctx, c, owner, lo.Without(inventory, applied...), observe)
+	return lo.Uniq(append(applied, left...)), err
+}
+
+// Prune deletes the objects of inventory that owner controls, in reverse, undoing the order
+// they were applied in. When a delete fails, it returns the entries not yet pruned, so that
+// nothing is forgotten.
+func Prune(ctx context.Context, c client.Client, owner client.Object, inventory []InventoryEntry, observe ObserveFunc) ([]InventoryEntry, error) {
+	if observe == nil {
+		observe = func(client.Object, Result, error) {}
+	}
+	for i := len(inventory) - 1; i >= 0; i-- {
+		entry := inventory[i]
+		obj, err := prune(ctx, c, owner, entry)
+		if obj == nil {
+			continue
+		}
+		observe(obj, ResultPruned, err)
+		if err != nil {
+			return inventory[:i+1], fmt.Errorf("pruning %v %v: %v", entry.Kind, entry.Name, err)
+		}
+	}
+	return nil, nil
+}
+
+// prune deletes the object of entry if owner controls it, returning the object it deleted or
+// failed to.
+func prune(ctx context.Context, c client.Client, owner client.Object, entry InventoryEntry) (pruned client.Object, err error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(schema.GroupVersionKind{Group: entry.Group, Version: entry.Version, Kind: entry.Kind})
+	obj.SetNamespace(owner.GetNamespace())
+	obj.SetName(entry.Name)
+	ctx, span := StartSpan(ctx, c, "Prune", obj)
+	defer func() { EndSpan(span, string(lo.Ternary(pruned != nil && err == nil, ResultPruned, "")), err) }()
+
+	err = c.Get(ctx, client.ObjectKeyFromObject(obj), obj)
+	// A missing kind means its CRD has since been uninstalled, taking its objects with it.
+	if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return obj, err
+	}
+	if !metav1.IsControlledBy(obj, owner) {
+		return nil, nil
+	}
+	// The precondition keeps an object recreated in the meantime from being deleted.
+	if err := c.Delete(ctx, obj, client.Preconditions{UID: lo.ToPtr(obj.GetUID())}); client.IgnoreNotFound(err) != nil {
+		return obj, err
+	}
+	return obj, nil
+}
+
+// InventoryEntryFor returns the inventory entry of obj.
+func InventoryEntryFor(c client.Client, obj client.Object) (InventoryEntry, error) {
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		return InventoryEntry{}, fmt.Errorf("looking up kind: %v", err)
+	}
+	return InventoryEntry{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind, Name: obj.GetName()}, nil
+}
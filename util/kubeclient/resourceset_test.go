@@ -0,0 +1,158 @@
+package kubeclient
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+var _ = Describe("ApplySet", func() {
+	var (
+		ctx      context.Context
+		owner    *corev1.ConfigMap
+		funcs    interceptor.Funcs
+		c        client.Client
+		observed []string
+		observe  ObserveFunc
+	)
+
+	// configMap returns a ConfigMap named name, controlled by owner if owned.
+	configMap := func(name string, owned bool) *corev1.ConfigMap {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: owner.Namespace, Name: name, UID: types.UID(name + "-uid")},
+			Data:       map[string]string{"key": name},
+		}
+		if owned {
+			Expect(controllerutil.SetControllerReference(owner, cm, scheme.Scheme)).To(Succeed())
+		}
+		return cm
+	}
+	entry := func(name string) InventoryEntry {
+		return InventoryEntry{Version: "v1", Kind: "ConfigMap", Name: name}
+	}
+	exists := func(name string) bool {
+		err := c.Get(ctx, client.ObjectKey{Namespace: owner.Namespace, Name: name}, &corev1.ConfigMap{})
+		Expect(client.IgnoreNotFound(err)).To(Succeed())
+		return err == nil
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		owner = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app", UID: "app-uid"}}
+		funcs = interceptor.Funcs{}
+		observed = nil
+		observe = func(obj client.Object, result Result, err error) {
+			observed = append(observed, fmt.Sprintf("%v %v", obj.GetName(), result))
+		}
+	})
+
+	// build creates the fake client holding objs, which goes through funcs.
+	build := func(objs ...client.Object) {
+		c = interceptor.NewClient(fake.NewClientBuilder().WithObjects(objs...).Build(), funcs)
+	}
+
+	It("should apply the desired objects and prune those that left the set", func() {
+		build(configMap("old", true), configMap("kept", true))
+
+		inventory, err := ApplySet(ctx, c, owner, []client.Object{configMap("kept", true), configMap("new", true)},
+			[]InventoryEntry{entry("old"), entry("kept")}, Options{}, observe)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inventory).To(ConsistOf(entry("kept"), entry("new")))
+		Expect(observed).To(Equal([]string{"kept updated", "new created", "old pruned"}))
+		Expect(exists("old")).To(BeFalse())
+		Expect(exists("new")).To(BeTrue())
+	})
+
+	It("should leave an object in the inventory that the owner doesn't control", func() {
+		build(configMap("foreign", false))
+
+		inventory, err := ApplySet(ctx, c, owner, nil, []InventoryEntry{entry("foreign")}, Options{}, observe)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inventory).To(BeEmpty())
+		Expect(observed).To(BeEmpty())
+		Expect(exists("foreign")).To(BeTrue())
+	})
+
+	It("should keep the previous inventory when an apply fails", func() {
+		funcs.Create = func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			if obj.GetName() == "broken" {
+				return errors.NewBadRequest("broken")
+			}
+			return c.Create(ctx, obj, opts...)
+		}
+		build(configMap("old", true))
+
+		inventory, err := ApplySet(ctx, c, owner, []client.Object{configMap("new", true), configMap("broken", true)},
+			[]InventoryEntry{entry("old")}, Options{}, observe)
+		Expect(err).To(MatchError(ContainSubstring("applying ConfigMap broken")))
+		Expect(inventory).To(ConsistOf(entry("old"), entry("new")))
+		Expect(exists("old")).To(BeTrue())
+	})
+
+	Describe("Prune", func() {
+		It("should delete in reverse and return what is left once a delete fails", func() {
+			funcs.Delete = func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+				if obj.GetName() == "second" {
+					return errors.NewForbidden(corev1.Resource("configmaps"), obj.GetName(), fmt.Errorf("denied"))
+				}
+				return c.Delete(ctx, obj, opts...)
+			}
+			build(configMap("first", true), configMap("second", true), configMap("third", true))
+
+			left, err := Prune(ctx, c, owner, []InventoryEntry{entry("first"), entry("second"), entry("third")}, observe)
+			Expect(err).To(MatchError(ContainSubstring("pruning ConfigMap second")))
+			Expect(left).To(Equal([]InventoryEntry{entry("first"), entry("second")}))
+			Expect(observed).To(Equal([]string{"third pruned", "second pruned"}))
+			Expect(exists("first")).To(BeTrue())
+		})
+
+		It("should not delete an object recreated since it was read", func() {
+			// The fake client doesn't check preconditions, so it is done here as the API server would.
+			funcs.Delete = func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+				deleteOpts := &client.DeleteOptions{}
+				deleteOpts.ApplyOptions(opts)
+				Expect(deleteOpts.Preconditions).NotTo(BeNil())
+				Expect(deleteOpts.Preconditions.UID).NotTo(BeNil())
+				live := &corev1.ConfigMap{}
+				if err := c.Get(ctx, client.ObjectKeyFromObject(obj), live); err != nil {
+					return err
+				}
+				if live.UID != *deleteOpts.Preconditions.UID {
+					return errors.NewConflict(corev1.Resource("configmaps"), obj.GetName(), fmt.Errorf("UID precondition failed"))
+				}
+				return c.Delete(ctx, obj, opts...)
+			}
+			recreated := false
+			funcs.Get = func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				if err := c.Get(ctx, key, obj, opts...); err != nil || recreated {
+					return err
+				}
+				// Someone else recreates the object right after prune reads it.
+				recreated = true
+				Expect(c.Delete(ctx, configMap(key.Name, true))).To(Succeed())
+				replacement := configMap(key.Name, true)
+				replacement.UID = "replacement-uid"
+				return c.Create(ctx, replacement)
+			}
+			build(configMap("old", true))
+
+			left, err := Prune(ctx, c, owner, []InventoryEntry{entry("old")}, observe)
+			Expect(err).To(MatchError(ContainSubstring("UID precondition failed")))
+			Expect(left).To(Equal([]InventoryEntry{entry("old")}))
+			live := &corev1.ConfigMap{}
+			Expect(c.Get(ctx, client.ObjectKey{Namespace: owner.Namespace, Name: "old"}, live)).To(Succeed())
+			Expect(live.UID).To(Equal(types.UID("replacement-uid")))
+		})
+	})
+})
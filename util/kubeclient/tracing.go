@@ -0,0 +1,61 @@
+package kubeclient
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// TracerName names the tracer kubeclient records its spans with.
+const TracerName = "neeraj.angi/app-operator/util/kubeclient"
+
+// Attributes of the spans recorded on an object.
+const (
+	AttributeKind      = attribute.Key("k8s.object.kind")
+	AttributeNamespace = attribute.Key("k8s.object.namespace")
+	AttributeName      = attribute.Key("k8s.object.name")
+	// AttributeHash is the hash of the desired state Apply records in AnnotationHash.
+	AttributeHash = attribute.Key("app_operator.hash")
+	// AttributeOutcome is the Result of an apply, or what became of an object otherwise.
+	AttributeOutcome = attribute.Key("app_operator.outcome")
+)
+
+// StartSpan starts a span named name acting on obj, tagged with its kind and name. The
+// tracer is looked up on every call, so that spans go to the TracerProvider installed last.
+func StartSpan(ctx context.Context, c client.Client, name string, obj client.Object) (context.Context, trace.Span) {
+	kind := fmt.Sprintf("%T", obj)
+	if gvk, err := apiutil.GVKForObject(obj, c.Scheme()); err == nil {
+		kind = gvk.Kind
+	}
+	return otel.Tracer(TracerName).Start(ctx, name, trace.WithAttributes(
+		AttributeKind.String(kind),
+		AttributeNamespace.String(obj.GetNamespace()),
+		AttributeName.String(obj.GetName()),
+	))
+}
+
+// EndSpan ends span, tagging it with outcome unless that is empty, and recording err.
+func EndSpan(span trace.Span, outcome string, err error) {
+	if outcome != "" {
+		span.SetAttributes(AttributeOutcome.String(outcome))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traced runs fn in a child span named name, so that the steps of an apply can be told apart.
+func traced(ctx context.Context, name string, fn func(context.Context) error) error {
+	ctx, span := otel.Tracer(TracerName).Start(ctx, name)
+	err := fn(ctx)
+	EndSpan(span, "", err)
+	return err
+}